@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Value on the stack of the parser. A terminal holds its Token, a nonterminal
+// holds Val returned by its action, and the list-like templates hold Items.
+// A nonterminal whose production has no action holds its syntax tree in Node.
+type Value[T any] struct {
+	Token *Token
+	Val   T
+	Items []Value[T]
+	Node  *Node
+}
+
+// ActionCtx gives the Action of a rule access to the values of the production,
+// either by the labels in Ops or by position.
+type ActionCtx[T any] struct {
+	rule   string
+	vals   []Value[T]
+	labels map[string]int
+	refs   *StrSet
+	err    error
+}
+
+// Get the value of the labelled symbol. The label must be listed in the Refs of
+// the rule, otherwise the parse fails with a semantics error when the
+// production is reduced.
+func (c *ActionCtx[T]) Get(label string) Value[T] {
+	if !c.refs.contains(label) {
+		if c.err == nil {
+			c.err = fmt.Errorf("label %s is not in the refs of rule %s", label, c.rule)
+		}
+		return Value[T]{}
+	}
+	return c.vals[c.labels[label]]
+}
+
+// Get the semantic value of the labelled nonterminal
+func (c *ActionCtx[T]) Val(label string) T {
+	return c.Get(label).Val
+}
+
+// Get the token of the labelled terminal
+func (c *ActionCtx[T]) Token(label string) *Token {
+	return c.Get(label).Token
+}
+
+// Get the value of the symbol at position i
+func (c *ActionCtx[T]) At(i int) Value[T] {
+	return c.vals[i]
+}
+
+// number of the values in the production
+func (c *ActionCtx[T]) Len() int {
+	return len(c.vals)
+}
+
+// Turn the RFunc or Action of ops into the semantics function of the
+// production. The refs of Action are checked against the labels of ops.
+func bindAction[T any](name string, ops *RuleOps[T], labels map[string]int) func([]Value[T]) (Value[T], error) {
+	if ops.vFunc != nil {
+		return ops.vFunc
+	}
+
+	if ops.Action == nil {
+		if len(ops.Refs) > 0 {
+			panic(fmt.Sprintf("rule %s has refs but no action", name))
+		}
+		if ops.RFunc == nil {
+			return nil
+		}
+
+		rFunc := ops.RFunc
+		return func(vals []Value[T]) (Value[T], error) {
+			result, err := rFunc(vals)
+			return Value[T]{Val: result}, err
+		}
+	}
+
+	if ops.RFunc != nil {
+		panic(fmt.Sprintf("rule %s has both RFunc and Action", name))
+	}
+
+	refs := createSet()
+	for _, ref := range ops.Refs {
+		if _, ok := labels[ref]; !ok {
+			panic(fmt.Sprintf("action of rule %s references undefined label %s in \"%s\"", name, ref, ops.Ops))
+		}
+		refs.add(ref)
+	}
+
+	action := ops.Action
+	return func(vals []Value[T]) (Value[T], error) {
+		ctx := &ActionCtx[T]{
+			rule:   name,
+			vals:   vals,
+			labels: labels,
+			refs:   refs,
+		}
+		result, err := action(ctx)
+		if err != nil {
+			return Value[T]{}, err
+		}
+		if ctx.err != nil {
+			return Value[T]{}, ctx.err
+		}
+		return Value[T]{Val: result}, nil
+	}
+}
+
+// A mid-rule action runs as soon as the symbols before it are parsed, e.g.
+// to open a scope in "FUNC NAME LPAREN {scope} params RPAREN body". It is
+// placed in Ops by {Name}, its context holds the values of the symbols before
+// it, and its result is the value of the symbol {Name}, which is labelled by
+// Name for the later actions.
+type MidAction[T any] struct {
+	Name   string
+	Refs   []string
+	Action func(*ActionCtx[T]) (T, error)
+}
+
+// Bind the mid-rule actions of ops to their placeholders in the symbols, and
+// label the placeholders. Returns the semantics functions by placeholder.
+func bindMidActions[T any](name string, ops *RuleOps[T], syms []string, labels map[string]int) map[string]any {
+	mids := make(map[string]any)
+	for _, mid := range ops.Mid {
+		placeholder := "{" + mid.Name + "}"
+		pos := -1
+		for i, sym := range syms {
+			if sym == placeholder {
+				if pos >= 0 {
+					panic(fmt.Sprintf("mid-rule action %s appears twice in rule %s", mid.Name, name))
+				}
+				pos = i
+			}
+		}
+		if pos < 0 {
+			panic(fmt.Sprintf("mid-rule action %s is not placed in \"%s\" of rule %s", mid.Name, ops.Ops, name))
+		}
+		if _, ok := labels[mid.Name]; ok {
+			panic(fmt.Sprintf("mid-rule action %s has the name of a label in rule %s", mid.Name, name))
+		}
+		if mid.Action == nil {
+			panic(fmt.Sprintf("mid-rule action %s of rule %s has no action", mid.Name, name))
+		}
+		labels[mid.Name] = pos
+	}
+
+	for _, mid := range ops.Mid {
+		// only the symbols before the action are parsed when it runs
+		pos := labels[mid.Name]
+		before := make(map[string]int)
+		for label, i := range labels {
+			if i < pos {
+				before[label] = i
+			}
+		}
+		mids["{"+mid.Name+"}"] = bindAction(name, &RuleOps[T]{
+			Ops:    ops.Ops,
+			Refs:   mid.Refs,
+			Action: mid.Action,
+		}, before)
+	}
+
+	for _, sym := range syms {
+		if isMidAction(sym) {
+			if _, ok := mids[sym]; !ok {
+				panic(fmt.Sprintf("no mid-rule action for %s in rule %s", sym, name))
+			}
+		}
+	}
+	return mids
+}
+
+func isMidAction(sym string) bool {
+	return strings.HasPrefix(sym, "{")
+}
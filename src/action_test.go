@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func createPairRules(refs []string, action func(*ActionCtx[string]) (string, error)) []*SyntaxRule[string] {
+	return []*SyntaxRule[string]{
+		{
+			Name: "pair",
+			Expand: []*RuleOps[string]{
+				{
+					Ops:    "LPAREN first=NUMBER COMMA second=NUMBER RPAREN",
+					Refs:   refs,
+					Action: action,
+				},
+			},
+		},
+	}
+}
+
+var pairSymbols = map[string]string{
+	"NUMBER": "[0-9]+",
+	"COMMA":  ",",
+	"LPAREN": "\\(",
+	"RPAREN": "\\)",
+}
+
+func TestSplitLabels(t *testing.T) {
+	ops, labels := splitLabels("expr", expStr2Arr("lhs = expr PLUS rhs=option(expr) %prec UMINUS"))
+	fmt.Println(ops, labels)
+	if len(ops) != 5 || ops[0] != "expr" || ops[2] != "option(expr)" {
+		t.Errorf("Unexpected ops %v", ops)
+	}
+	if labels["lhs"] != 0 || labels["rhs"] != 2 || len(labels) != 2 {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+}
+
+func TestLabelAction(t *testing.T) {
+	rules := createPairRules([]string{"first", "second"}, func(ctx *ActionCtx[string]) (string, error) {
+		return ctx.Token("second").Value + ctx.Token("first").Value, nil
+	})
+	p := CreateParser(pairSymbols, []string{" "}, rules, []*Precedence{})
+
+	result, err := p.Parse("(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "21" {
+		t.Errorf("Expected 21, got %s", result)
+	}
+}
+
+func TestUndeclaredRef(t *testing.T) {
+	for _, label := range []string{"second", "typo"} {
+		runs := 0
+		rules := createPairRules([]string{"first"}, func(ctx *ActionCtx[string]) (string, error) {
+			runs++
+			return ctx.Token("first").Value + ctx.Val(label), nil
+		})
+		p := CreateParser(pairSymbols, []string{" "}, rules, []*Precedence{})
+		if runs != 0 {
+			t.Errorf("Expected the action not run when the parser is created")
+		}
+		if _, err := p.Parse("(1, 2)"); err == nil || !strings.Contains(err.Error(), "label "+label+" is not in the refs") {
+			t.Errorf("Expected an error for label %s not in refs, got %v", label, err)
+		}
+	}
+}
+
+func TestUndefinedLabel(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for undefined label")
+		}
+	}()
+
+	rules := createPairRules([]string{"first", "third"}, func(ctx *ActionCtx[string]) (string, error) {
+		return ctx.Token("first").Value, nil
+	})
+	CreateParser(pairSymbols, []string{" "}, rules, []*Precedence{})
+}
+
+func TestMidAction(t *testing.T) {
+	log := make([]string, 0)
+	rules := []*SyntaxRule[string]{
+		{
+			Name: "pair",
+			Expand: []*RuleOps[string]{
+				{
+					Ops:  "LPAREN first=NUMBER {open} COMMA second=number RPAREN",
+					Refs: []string{"open", "second"},
+					Action: func(ctx *ActionCtx[string]) (string, error) {
+						return ctx.Val("open") + ctx.Val("second"), nil
+					},
+					Mid: []*MidAction[string]{
+						{
+							Name: "open",
+							Refs: []string{"first"},
+							Action: func(ctx *ActionCtx[string]) (string, error) {
+								log = append(log, "open")
+								return ctx.Token("first").Value + ":", nil
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name: "number",
+			Expand: []*RuleOps[string]{
+				{
+					Ops: "NUMBER",
+					RFunc: func(vals []Value[string]) (string, error) {
+						log = append(log, "number")
+						return vals[0].Token.Value, nil
+					},
+				},
+			},
+		},
+	}
+	p := CreateParser(pairSymbols, []string{" "}, rules, []*Precedence{})
+
+	result, err := p.Parse("(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "1:2" {
+		t.Errorf("Expected 1:2, got %s", result)
+	}
+	if len(log) != 2 || log[0] != "open" {
+		t.Errorf("Expected the mid-rule action first, got %v", log)
+	}
+
+	tree, err := p.ParseTree("(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Children) != 5 {
+		t.Errorf("Unexpected tree %s", tree)
+	}
+}
+
+func TestMidActionConflict(t *testing.T) {
+	mid := func(name string) []*MidAction[string] {
+		return []*MidAction[string]{
+			{
+				Name: name,
+				Action: func(ctx *ActionCtx[string]) (string, error) {
+					return name, nil
+				},
+			},
+		}
+	}
+	rules := []*SyntaxRule[string]{
+		{
+			Name: "pair",
+			Expand: []*RuleOps[string]{
+				{Ops: "LPAREN {a} NUMBER RPAREN", Mid: mid("a")},
+				{Ops: "LPAREN {b} NUMBER COMMA NUMBER RPAREN", Mid: mid("b")},
+			},
+		},
+	}
+	p := CreateParser(pairSymbols, []string{" "}, rules, []*Precedence{})
+	conflicts := p.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Kind != ReduceReduce {
+		t.Fatalf("Expected a reduce/reduce conflict, got %v", conflicts)
+	}
+	if !strings.Contains(conflicts[0].Items[0], "mid-rule action {a} in pair -> LPAREN {a} NUMBER") {
+		t.Errorf("Expected the mid-rule action in the conflict, got %s", conflicts[0].Items[0])
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GenerateAST emits the Go source of the AST of the annotated rules:
+//
+//   - a struct per alternative with ASTNode set, whose fields are the labelled
+//     symbols of the alternative
+//   - an interface per nonterminal implemented by the structs it can reduce to,
+//     or the struct itself when the nonterminal has a single alternative
+//   - ASTRules, the rules whose actions build the nodes, typed SyntaxRule[ASTNode]
+//   - a Visitor and Walk in the style of go/ast
+//
+// An alternative without ASTNode must label exactly one nonterminal, whose node
+// is passed through, e.g. "LPAREN inner=expr RPAREN". The templates of the
+// rules are such pass throughs, e.g. "LBRACE x=X RBRACE", and are kept in
+// ASTRules with their params.
+//
+// The generated code uses the types of goblin, e.g. SyntaxRule, Value and
+// Token, which are not importable since goblin is a main package, so the
+// generated file must be compiled with the sources of goblin, and pkg must be
+// their package.
+func GenerateAST[T any](pkg string, rules []*SyntaxRule[T]) ([]byte, error) {
+	gen, err := createASTGen(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	source := gen.emit(pkg)
+	formatted, fmtErr := format.Source([]byte(source))
+	if fmtErr != nil {
+		return nil, fmt.Errorf("generated AST is invalid: %v", fmtErr)
+	}
+	return formatted, nil
+}
+
+var astReserved = []string{"ASTNode", "Visitor", "Walk", "ASTRules"}
+
+type astAlt struct {
+	ops    string
+	syms   []string
+	labels []string // in the order of the symbols
+	pos    map[string]int
+	node   string // struct name, empty for a pass through
+	// the rule whose node is passed through
+	through string
+}
+
+type astRule struct {
+	name   string
+	params []string
+	alts   []*astAlt
+	iface  string // interface of the nonterminal, empty if it is a single struct
+	typ    string // go type of the values of the nonterminal
+}
+
+type astGen struct {
+	rules []*astRule
+	// the templates of the rules, by name
+	templates     map[string]*astRule
+	templateNames []string
+	ruleMap       map[string]*astRule
+	structs       map[string]*astAlt
+	// structs implementing the interface of each rule
+	impls map[string]*StrSet
+}
+
+func createASTGen[T any](rules []*SyntaxRule[T]) (*astGen, error) {
+	gen := &astGen{
+		rules:     make([]*astRule, 0),
+		ruleMap:   make(map[string]*astRule),
+		structs:   make(map[string]*astAlt),
+		templates: make(map[string]*astRule),
+		impls:     make(map[string]*StrSet),
+	}
+	reserved := createSet()
+	reserved.addArr(astReserved)
+
+	for _, rule := range rules {
+		r := &astRule{
+			name:   rule.Name,
+			params: rule.Params,
+			alts:   make([]*astAlt, 0),
+		}
+		if len(rule.Params) > 0 {
+			gen.templates[rule.Name] = r
+			gen.templateNames = append(gen.templateNames, rule.Name)
+		} else {
+			gen.rules = append(gen.rules, r)
+			gen.ruleMap[rule.Name] = r
+		}
+
+		for _, ops := range rule.Expand {
+			syms, pos := splitLabels(rule.Name, expStr2Arr(ops.Ops))
+			alt := &astAlt{
+				ops:    ops.Ops,
+				syms:   syms,
+				labels: make([]string, 0),
+				pos:    pos,
+				node:   ops.ASTNode,
+			}
+			for label := range pos {
+				alt.labels = append(alt.labels, label)
+			}
+			sort.Slice(alt.labels, func(i, j int) bool {
+				return pos[alt.labels[i]] < pos[alt.labels[j]]
+			})
+			r.alts = append(r.alts, alt)
+
+			if alt.node == "" {
+				continue
+			}
+			if len(rule.Params) > 0 {
+				return nil, fmt.Errorf("AST node %s of template %s is not supported, a template can only pass a node through", alt.node, rule.Name)
+			}
+			if !isExportedIdent(alt.node) {
+				return nil, fmt.Errorf("AST node %s of rule %s is not an exported name", alt.node, rule.Name)
+			}
+			if _, ok := gen.structs[alt.node]; ok || reserved.contains(alt.node) {
+				return nil, fmt.Errorf("duplicate AST node %s in rule %s", alt.node, rule.Name)
+			}
+			gen.structs[alt.node] = alt
+		}
+	}
+
+	for _, name := range gen.templateNames {
+		for _, alt := range gen.templates[name].alts {
+			if len(alt.labels) != 1 {
+				return nil, fmt.Errorf("alternative \"%s\" of template %s needs exactly one label", alt.ops, name)
+			}
+		}
+	}
+
+	// the type of each nonterminal
+	for _, r := range gen.rules {
+		for _, alt := range r.alts {
+			for _, label := range alt.labels {
+				if err := gen.checkTemplates(alt.syms[alt.pos[label]]); err != nil {
+					return nil, err
+				}
+			}
+			if alt.node != "" {
+				continue
+			}
+			if len(alt.labels) != 1 {
+				return nil, fmt.Errorf("alternative \"%s\" of rule %s needs an AST node or exactly one label", alt.ops, r.name)
+			}
+			through, err := gen.resolve(alt.syms[alt.pos[alt.labels[0]]], 0)
+			if err != nil {
+				return nil, fmt.Errorf("alternative \"%s\" of rule %s: %v", alt.ops, r.name, err)
+			}
+			alt.through = through
+		}
+
+		if len(r.alts) == 1 && r.alts[0].node != "" {
+			r.typ = "*" + r.alts[0].node
+			continue
+		}
+		r.iface = astCamel(r.name)
+		r.typ = r.iface
+		if _, ok := gen.structs[r.iface]; ok || reserved.contains(r.iface) {
+			return nil, fmt.Errorf("interface %s of rule %s conflicts with an AST node", r.iface, r.name)
+		}
+		gen.impls[r.iface] = createSet()
+	}
+
+	// the structs flowing into each interface, including the pass throughs
+	for {
+		changed := false
+		for _, r := range gen.rules {
+			if r.iface == "" {
+				continue
+			}
+			impl := gen.impls[r.iface]
+			size := impl.size()
+			for _, alt := range r.alts {
+				if alt.node != "" {
+					impl.add(alt.node)
+					continue
+				}
+				through := gen.ruleMap[alt.through]
+				if through.iface == "" {
+					impl.add(through.alts[0].node)
+				} else {
+					impl.addSet(gen.impls[through.iface])
+				}
+			}
+			if impl.size() != size {
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	// fields of the structs
+	for name, alt := range gen.structs {
+		fields := createSet()
+		for _, label := range alt.labels {
+			field := astCamel(label)
+			if fields.contains(field) {
+				return nil, fmt.Errorf("duplicate field %s in AST node %s", field, name)
+			}
+			fields.add(field)
+		}
+	}
+
+	return gen, nil
+}
+
+// The rule whose node sym passes through: sym itself, or the rule a call of
+// a template of the rules passes through.
+func (gen *astGen) resolve(sym string, depth int) (string, error) {
+	if _, ok := gen.ruleMap[sym]; ok {
+		return sym, nil
+	}
+	if !isTemplateCall(sym) {
+		return "", fmt.Errorf("%s passes through a symbol which is not a rule", sym)
+	}
+	name, args := splitTemplateCall(sym)
+	t, ok := gen.templates[name]
+	if !ok {
+		return "", fmt.Errorf("%s passes through a symbol which is not a rule", sym)
+	}
+	if len(args) != len(t.params) {
+		return "", fmt.Errorf("template %s takes %d arguments, got %d in %s", name, len(t.params), len(args), sym)
+	}
+	if depth > maxTemplateDepth {
+		return "", fmt.Errorf("template call %s is nested too deeply", sym)
+	}
+
+	bindings := make(map[string]string)
+	for i, param := range t.params {
+		bindings[param] = args[i]
+	}
+	result := ""
+	for _, alt := range t.alts {
+		through, err := gen.resolve(substTemplateParams(alt.syms[alt.pos[alt.labels[0]]], bindings), depth+1)
+		if err != nil {
+			return "", err
+		}
+		if result != "" && through != result {
+			return "", fmt.Errorf("the alternatives of template %s pass through %s and %s in %s", name, result, through, sym)
+		}
+		result = through
+	}
+	return result, nil
+}
+
+// check the calls of the templates of the rules in sym, including those in the
+// arguments of the standard templates
+func (gen *astGen) checkTemplates(sym string) error {
+	if !isTemplateCall(sym) {
+		return nil
+	}
+	name, args := splitTemplateCall(sym)
+	if _, ok := gen.templates[name]; ok {
+		_, err := gen.resolve(sym, 0)
+		return err
+	}
+	for _, arg := range args {
+		if err := gen.checkTemplates(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return the function converting a Value[ASTNode] of sym to its go type, and
+// the go type.
+func (gen *astGen) conv(sym string) (string, string) {
+	if r, ok := gen.ruleMap[sym]; ok {
+		return "ast" + strings.TrimPrefix(r.typ, "*"), r.typ
+	}
+	if !isTemplateCall(sym) {
+		return "astToken", "*Token"
+	}
+
+	name, args := splitTemplateCall(sym)
+	if _, ok := gen.templates[name]; ok {
+		// checked by createASTGen
+		through, _ := gen.resolve(sym, 0)
+		return gen.conv(through)
+	}
+	switch name {
+	case "list", "nonempty_list":
+		f, t := gen.conv(args[0])
+		return fmt.Sprintf("func(v Value[ASTNode]) []%s { return astList(v, %s) }", t, f), "[]" + t
+	case "separated_list", "separated_nonempty_list":
+		f, t := gen.conv(args[1])
+		return fmt.Sprintf("func(v Value[ASTNode]) []%s { return astList(v, %s) }", t, f), "[]" + t
+	case "option":
+		f, t := gen.conv(args[0])
+		return fmt.Sprintf("func(v Value[ASTNode]) %s { return astOption(v, %s) }", t, f), t
+	case "delimited":
+		return gen.conv(args[1])
+	case "preceded":
+		return gen.conv(args[1])
+	case "terminated":
+		return gen.conv(args[0])
+	}
+	return "astValue", "Value[ASTNode]"
+}
+
+// statements walking expr of type typ
+func (gen *astGen) walk(expr string, typ string, depth int) string {
+	if typ == "*Token" || typ == "Value[ASTNode]" {
+		return ""
+	}
+	if strings.HasPrefix(typ, "[]") {
+		item := fmt.Sprintf("item%d", depth)
+		inner := gen.walk(item, typ[2:], depth+1)
+		if inner == "" {
+			return ""
+		}
+		return fmt.Sprintf("for _, %s := range %s {\n%s}\n", item, expr, inner)
+	}
+	return fmt.Sprintf("if %s != nil {\nWalk(v, %s)\n}\n", expr, expr)
+}
+
+func (gen *astGen) emit(pkg string) string {
+	result := "// Code generated by goblin GenerateAST. DO NOT EDIT.\n\n"
+	result += fmt.Sprintf("package %s\n\n", pkg)
+
+	result += "// ASTNode is implemented by all the nodes of the AST.\n"
+	result += "type ASTNode interface {\n\tastNode()\n}\n\n"
+
+	// interfaces
+	for _, r := range gen.rules {
+		if r.iface == "" {
+			continue
+		}
+		result += fmt.Sprintf("// %s is the AST of nonterminal %s.\n", r.iface, r.name)
+		result += fmt.Sprintf("type %s interface {\n\tASTNode\n\tis%s()\n}\n\n", r.iface, r.iface)
+	}
+
+	// structs
+	for _, r := range gen.rules {
+		for _, alt := range r.alts {
+			if alt.node == "" {
+				continue
+			}
+			result += fmt.Sprintf("// %s is the AST of %s -> %s\n", alt.node, r.name, strings.TrimSpace(alt.ops))
+			result += fmt.Sprintf("type %s struct {\n", alt.node)
+			for _, label := range alt.labels {
+				_, t := gen.conv(alt.syms[alt.pos[label]])
+				result += fmt.Sprintf("\t%s %s\n", astCamel(label), t)
+			}
+			result += "}\n\n"
+			result += fmt.Sprintf("func (*%s) astNode() {}\n", alt.node)
+			for _, other := range gen.rules {
+				if other.iface != "" && gen.impls[other.iface].contains(alt.node) {
+					result += fmt.Sprintf("func (*%s) is%s() {}\n", alt.node, other.iface)
+				}
+			}
+			result += "\n"
+		}
+	}
+
+	// visitor
+	result += "// A Visitor's Visit method is invoked for each node encountered by Walk.\n"
+	result += "// If the result visitor w is not nil, Walk visits each of the children\n"
+	result += "// of node with the visitor w, followed by a call of w.Visit(nil).\n"
+	result += "type Visitor interface {\n\tVisit(node ASTNode) (w Visitor)\n}\n\n"
+	result += "// Walk traverses the AST in depth-first order.\n"
+	result += "func Walk(v Visitor, node ASTNode) {\n"
+	result += "if v = v.Visit(node); v == nil {\nreturn\n}\n\n"
+	result += "switch n := node.(type) {\n"
+	for _, r := range gen.rules {
+		for _, alt := range r.alts {
+			if alt.node == "" {
+				continue
+			}
+			result += fmt.Sprintf("case *%s:\n", alt.node)
+			for _, label := range alt.labels {
+				_, t := gen.conv(alt.syms[alt.pos[label]])
+				result += gen.walk("n."+astCamel(label), t, 0)
+			}
+		}
+	}
+	result += "}\n\nv.Visit(nil)\n}\n\n"
+
+	// rules
+	result += "// ASTRules returns the rules of the grammar whose actions build the AST.\n"
+	result += "func ASTRules() []*SyntaxRule[ASTNode] {\n"
+	result += "return []*SyntaxRule[ASTNode]{\n"
+	all := append([]*astRule{}, gen.rules...)
+	for _, name := range gen.templateNames {
+		all = append(all, gen.templates[name])
+	}
+	for _, r := range all {
+		result += fmt.Sprintf("{\nName: %s,\n", strconv.Quote(r.name))
+		if len(r.params) > 0 {
+			params := make([]string, 0, len(r.params))
+			for _, param := range r.params {
+				params = append(params, strconv.Quote(param))
+			}
+			result += fmt.Sprintf("Params: []string{%s},\n", strings.Join(params, ", "))
+		}
+		result += "Expand: []*RuleOps[ASTNode]{\n"
+		for _, alt := range r.alts {
+			refs := make([]string, 0)
+			for _, label := range alt.labels {
+				refs = append(refs, strconv.Quote(label))
+			}
+			result += "{\n"
+			result += fmt.Sprintf("Ops: %s,\n", strconv.Quote(alt.ops))
+			result += fmt.Sprintf("Refs: []string{%s},\n", strings.Join(refs, ", "))
+			if alt.node != "" {
+				result += fmt.Sprintf("ASTNode: %s,\n", strconv.Quote(alt.node))
+			}
+			result += "Action: func(ctx *ActionCtx[ASTNode]) (ASTNode, error) {\n"
+			if alt.node == "" {
+				result += fmt.Sprintf("return ctx.Val(%s), nil\n", strconv.Quote(alt.labels[0]))
+			} else {
+				result += fmt.Sprintf("return &%s{\n", alt.node)
+				for _, label := range alt.labels {
+					f, _ := gen.conv(alt.syms[alt.pos[label]])
+					result += fmt.Sprintf("%s: (%s)(ctx.Get(%s)),\n", astCamel(label), f, strconv.Quote(label))
+				}
+				result += "}, nil\n"
+			}
+			result += "},\n},\n"
+		}
+		result += "},\n},\n"
+	}
+	result += "}\n}\n\n"
+
+	// conversions
+	for _, r := range gen.rules {
+		name := strings.TrimPrefix(r.typ, "*")
+		result += fmt.Sprintf("func ast%s(v Value[ASTNode]) %s {\nn, _ := v.Val.(%s)\nreturn n\n}\n\n", name, r.typ, r.typ)
+	}
+	result += "func astToken(v Value[ASTNode]) *Token {\nreturn v.Token\n}\n\n"
+	result += "func astValue(v Value[ASTNode]) Value[ASTNode] {\nreturn v\n}\n\n"
+	result += "func astList[E any](v Value[ASTNode], conv func(Value[ASTNode]) E) []E {\n"
+	result += "result := make([]E, 0, len(v.Items))\n"
+	result += "for _, item := range v.Items {\nresult = append(result, conv(item))\n}\n"
+	result += "return result\n}\n\n"
+	result += "func astOption[E any](v Value[ASTNode], conv func(Value[ASTNode]) E) E {\n"
+	result += "var zero E\nif len(v.Items) == 0 {\nreturn zero\n}\n"
+	result += "return conv(v.Items[0])\n}\n"
+
+	return result
+}
+
+// turn snake_case, lowerCamel or a namespaced name into an exported name
+func astCamel(s string) string {
+	result := ""
+	upper := true
+	for _, c := range s {
+		if c == '_' || c == '.' {
+			upper = true
+			continue
+		}
+		if upper {
+			result += string(unicode.ToUpper(c))
+			upper = false
+		} else {
+			result += string(c)
+		}
+	}
+	return result
+}
+
+func isExportedIdent(s string) bool {
+	for i, c := range s {
+		if i == 0 && !unicode.IsUpper(c) {
+			return false
+		}
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return s != ""
+}
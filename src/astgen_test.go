@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var astSymbols = map[string]string{
+	"NAME":     "[a-zA-Z_][a-zA-Z0-9_]*",
+	"NUMBER":   "[0-9]+",
+	"PLUS":     "\\+",
+	"MULTIPLY": "\\*",
+	"ASSIGN":   "=",
+	"SEMI":     ";",
+	"COMMA":    ",",
+	"LPAREN":   "\\(",
+	"RPAREN":   "\\)",
+}
+
+func createASTRules() []*SyntaxRule[any] {
+	return []*SyntaxRule[any]{
+		{
+			Name: "program",
+			Expand: []*RuleOps[any]{
+				{Ops: "stmts=list(statement)", ASTNode: "Program"},
+			},
+		},
+		{
+			Name: "statement",
+			Expand: []*RuleOps[any]{
+				{Ops: "name=NAME ASSIGN value=expr SEMI", ASTNode: "Assign"},
+				{Ops: "value=expr SEMI"},
+			},
+		},
+		{
+			Name: "expr",
+			Expand: []*RuleOps[any]{
+				{Ops: "lhs=expr op=PLUS rhs=expr", ASTNode: "Sum"},
+				{Ops: "lhs=expr op=MULTIPLY rhs=expr", ASTNode: "Product"},
+				{Ops: "inner=parens(expr)"},
+				{Ops: "value=NUMBER", ASTNode: "Number"},
+				{Ops: "name=NAME", ASTNode: "Ident"},
+				{Ops: "fn=NAME LPAREN args=separated_list(COMMA, expr) RPAREN", ASTNode: "Call"},
+			},
+		},
+		{
+			Name:   "parens",
+			Params: []string{"X"},
+			Expand: []*RuleOps[any]{
+				{Ops: "LPAREN x=X RPAREN"},
+			},
+		},
+	}
+}
+
+func TestGenerateAST(t *testing.T) {
+	source, err := GenerateAST("main", createASTRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"type Statement interface",
+		"type Expr interface",
+		"Stmts []Statement",
+		"Args []Expr",
+		"Op  *Token",
+		"func (*Sum) isStatement() {}",
+		"func Walk(v Visitor, node ASTNode)",
+		"func ASTRules() []*SyntaxRule[ASTNode]",
+		"Params: []string{\"X\"},",
+	}
+	for _, e := range expected {
+		if !strings.Contains(string(source), e) {
+			t.Errorf("Expected %s in generated AST", e)
+		}
+	}
+	// program has a single alternative, so no interface is needed
+	if strings.Contains(string(source), "type Program interface") {
+		t.Errorf("Unexpected interface of program")
+	}
+}
+
+func TestGenerateASTErrors(t *testing.T) {
+	rules := createASTRules()
+	rules[2].Expand[3].ASTNode = "Sum"
+	if _, err := GenerateAST("main", rules); err == nil {
+		t.Errorf("Expected error for duplicate AST node")
+	}
+
+	rules = createASTRules()
+	rules[2].Expand[3].ASTNode = ""
+	if _, err := GenerateAST("main", rules); err == nil {
+		t.Errorf("Expected error for passing through a terminal")
+	}
+
+	// a template passing through a terminal, or building a node
+	rules = createASTRules()
+	rules[2].Expand[4].Ops = "name=parens(NAME)"
+	rules[2].Expand[4].ASTNode = ""
+	if _, err := GenerateAST("main", rules); err == nil || !strings.Contains(err.Error(), "not a rule") {
+		t.Errorf("Expected error for a template passing through a terminal, got %v", err)
+	}
+	rules = createASTRules()
+	rules[3].Expand[0].ASTNode = "Parens"
+	if _, err := GenerateAST("main", rules); err == nil {
+		t.Errorf("Expected error for an AST node in a template")
+	}
+}
+
+// Build the generated AST together with goblin and walk a parsed program.
+func TestGeneratedASTRuns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip building the generated code in short mode")
+	}
+	goBin, lookErr := exec.LookPath("go")
+	if lookErr != nil {
+		t.Skip("go is not available")
+	}
+
+	source, err := GenerateAST("main", createASTRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, content []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		content, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(f, content)
+	}
+	write("ast_gen.go", source)
+	write("go.mod", []byte("module astgen\n\ngo 1.21\n"))
+
+	symbols := "map[string]string{\n"
+	for k, v := range astSymbols {
+		symbols += "\"" + k + "\": `" + v + "`,\n"
+	}
+	symbols += "}"
+	main := `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type printer struct {
+	names *[]string
+}
+
+func (p printer) Visit(node ASTNode) Visitor {
+	if node != nil {
+		*p.names = append(*p.names, strings.TrimPrefix(fmt.Sprintf("%T", node), "*main."))
+	}
+	return p
+}
+
+func main() {
+	p := CreateParser(` + symbols + `, []string{" "}, ASTRules(), []*Precedence{
+		{TokenType: []string{"PLUS"}, Level: 1},
+		{TokenType: []string{"MULTIPLY"}, Level: 2},
+	})
+	tree, err := p.Parse("a = 1 + 2 * 3; f(a, (4));")
+	if err != nil {
+		panic(err)
+	}
+	names := []string{}
+	Walk(printer{&names}, tree)
+	fmt.Print(strings.Join(names, " "))
+}
+`
+	write("main.go", []byte(main))
+
+	cmd := exec.Command(goBin, "run", ".")
+	cmd.Dir = dir
+	out, runErr := cmd.CombinedOutput()
+	if runErr != nil {
+		t.Fatalf("%v\n%s", runErr, out)
+	}
+
+	expected := "Program Assign Sum Number Product Number Number Call Ident Number"
+	if !strings.HasSuffix(string(out), expected) {
+		t.Errorf("Expected %s, got %s", expected, out)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CacheDir is the directory where CreateParser keeps the tables it builds,
+// each in a file named after the grammar and the method, and the fingerprint
+// of the grammar with its options. A parser whose tables are in the cache
+// loads them instead of building them, like LoadParser, and builds its LR
+// states the first time WriteMDInfo, Conflicts or ParseForest need them. The
+// fingerprint covers the lexer rules, the productions, the precedence, the
+// options and the version of the format of the tables, so a change of any of
+// them builds and caches the tables again. The new tables replace those of
+// the same grammar and method only, so the tables of other grammars and
+// methods in the directory are kept, and so are those of a grammar which has
+// changed since.
+type CacheDir string
+
+func (d CacheDir) apply(c *parserConfig) {
+	c.cacheDir = string(d)
+}
+
+// The fingerprint of the grammar with the options building its tables
+func (c *parserConfig) fingerprint(lrules map[string]string, ignore []string, g *grammar) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "version %d\n", tablesVersion)
+	fmt.Fprintf(&b, "method %s\n", c.method)
+	if c.expect != nil {
+		fmt.Fprintf(&b, "expect %d %d\n", c.expect.ShiftReduce, c.expect.ReduceReduce)
+	}
+	for _, name := range genSortedKeys(lrules) {
+		fmt.Fprintf(&b, "lex %q %q\n", name, lrules[name])
+	}
+	fmt.Fprintf(&b, "ignore %q\n", ignore)
+	precs := make([]string, 0, len(g.precedence))
+	for tokenType, level := range g.precedence {
+		precs = append(precs, fmt.Sprintf("%s=%d", tokenType, level))
+	}
+	sort.Strings(precs)
+	fmt.Fprintf(&b, "precedence %s\n", strings.Join(precs, " "))
+	fmt.Fprintf(&b, "grammar %s\n", g.hash())
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load the tables of the grammar from the cache, or build them and write
+// them into the cache. A cache which can not be read or written is warned
+// about and the tables are built.
+func createCachedParser[T any](config *parserConfig, lrules map[string]string, ignore []string, lexer *Lexer, srules []*SyntaxRule[T], precedence []*Precedence) *Parser[T] {
+	grammar := defineGrammar(lexer, srules, precedence)
+	prefix := cacheKey(grammar, config.method) + "-"
+	path := filepath.Join(config.cacheDir, prefix+config.fingerprint(lrules, ignore, grammar)+".tables")
+	if tables, err := os.ReadFile(path); err == nil {
+		p, loadErr := loadTables[T](tables, lexer, grammar)
+		if loadErr == nil {
+			return p
+		}
+		fmt.Printf("cached tables %s are invalid: %v !! \n", path, loadErr)
+	}
+
+	grammar.prepare()
+	table := buildParallelLRTable(grammar, config.method, config.workers)
+	table.checkConflicts(config.expect)
+	p := newParser[T](lexer, grammar, table)
+
+	if err := p.writeCache(path); err != nil {
+		fmt.Printf("can not cache the tables in %s: %v !! \n", path, err)
+	} else {
+		removeStaleCache(path, prefix)
+	}
+	return p
+}
+
+// The prefix of the names of the cached tables of the grammar built by method
+func cacheKey(g *grammar, method TableMethod) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %s", g.hash(), method)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Remove the tables cached with prefix, i.e. for the same grammar and method,
+// except those of path, which are of other lexer rules or options, or of an
+// older version of the format
+func removeStaleCache(path string, prefix string) {
+	stale, _ := filepath.Glob(filepath.Join(filepath.Dir(path), prefix+"*.tables"))
+	for _, file := range stale {
+		if file != path {
+			os.Remove(file)
+		}
+	}
+}
+
+// Write the tables into a temporary file renamed to path, so that a parser
+// never reads tables half written
+func (p *Parser[T]) writeCache(path string) error {
+	tables, err := p.MarshalTables()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, writeErr := file.Write(tables)
+	closeErr := file.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr == nil {
+		writeErr = os.Rename(file.Name(), path)
+	}
+	if writeErr != nil {
+		os.Remove(file.Name())
+	}
+	return writeErr
+}
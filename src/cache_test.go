@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	create := func(opts ...Option) *Parser[string] {
+		opts = append(opts, CacheDir(dir))
+		return CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, opts...)
+	}
+	cached := func() []string {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.tables"))
+		return files
+	}
+
+	built := create(LR1)
+	if len(built.table.closures) == 0 || len(cached()) != 1 {
+		t.Fatalf("Expected the tables built and cached")
+	}
+	path := cached()[0]
+	loaded := create(LR1)
+	if len(loaded.table.closures) != 0 {
+		t.Errorf("Expected the tables loaded from the cache")
+	}
+	for _, input := range []string{"a x c", "b x d"} {
+		want, _ := built.Parse(input)
+		result, err := loaded.Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want {
+			t.Errorf("Expected %s for %s, got %s", want, input, result)
+		}
+	}
+
+	// the tables of another method are kept
+	create(MinimalLR1)
+	if len(cached()) != 2 {
+		t.Errorf("Expected the tables of both methods cached, got %v", cached())
+	}
+	// and so are those of another grammar with the same start rule
+	rules := createLR1Rules()
+	rules[0].Expand = rules[0].Expand[:3]
+	CreateParser(lr1Symbols, []string{" "}, rules, []*Precedence{}, CacheDir(dir), LR1)
+	if len(cached()) != 3 {
+		t.Errorf("Expected the tables of both grammars cached, got %v", cached())
+	}
+	// the tables of the same grammar and method with other options are
+	// replaced
+	create(LR1, Expect{})
+	if files := cached(); len(files) != 3 || containsStr(files, path) {
+		t.Errorf("Expected the tables of the other options only, got %v", files)
+	}
+	create(LR1)
+	if files := cached(); len(files) != 3 || !containsStr(files, path) {
+		t.Errorf("Expected the tables of LR(1) cached again, got %v", files)
+	}
+	// the LR states of cached tables are built when they are needed
+	if len(create(LR1).lrStates().closures) != len(built.table.closures) {
+		t.Errorf("Expected the states of the built parser")
+	}
+
+	// invalid tables are built again
+	os.WriteFile(path, []byte("GOBLINTB broken"), 0644)
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, CacheDir(dir), LR1)
+	if _, err := p.Parse("a x d"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) == "GOBLINTB broken" {
+		t.Errorf("Expected the cached tables written again")
+	}
+}
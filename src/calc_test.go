@@ -8,10 +8,10 @@ import (
 
 type calcParser struct {
 	vars   map[string]int
-	parser *Parser
+	parser *Parser[int]
 }
 
-func createCalc() *calcParser {
+func createCalc(opts ...Option) *calcParser {
 	vars := make(map[string]int)
 
 	// lexer rules
@@ -56,160 +56,93 @@ func createCalc() *calcParser {
 		},
 	}
 
-	rules := []*SyntaxRule {
+	// evaluate lhs op rhs
+	binary := func(op func(int, int) int) func(ctx *ActionCtx[int]) (int, error) {
+		return func(ctx *ActionCtx[int]) (int, error) {
+			return op(ctx.Val("lhs"), ctx.Val("rhs")), nil
+		}
+	}
+
+	rules := []*SyntaxRule[int] {
 		{
 			Name: "statement",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[int] {
 				{
-					Ops: "NAME ASSIGN expr",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						key := string(pvals[0].GetValue())
-						// string to int
-						num, valErr := tokenValue2Int(pvals[2].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						vars[key] = num
-
-						return &Token {
-							Type: "NUMBER",
-							Value: "0",
-						}, nil
+					Ops: "name=NAME ASSIGN value=expr",
+					Refs: []string{"name", "value"},
+					Action: func(ctx *ActionCtx[int]) (int, error) {
+						vars[ctx.Token("name").Value] = ctx.Val("value")
+						return 0, nil
 					},
 				},
 				{
 					Ops: "expr",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						return pvals[0], nil
+					RFunc: func(vals []Value[int]) (int, error) {
+						return vals[0].Val, nil
 					},
 				},
 			},
 		},
 		{
 			Name: "expr",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[int] {
 				{
-					Ops: "expr PLUS expr",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						// string to int
-						num1, valErr := tokenValue2Int(pvals[0].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num2, valErr := tokenValue2Int(pvals[2].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num := num1 + num2
-						return &Token {
-							Type: "NUMBER",
-							Value: fmt.Sprintf("%d", num),
-						}, nil
-					},
+					Ops: "lhs=expr PLUS rhs=expr",
+					Refs: []string{"lhs", "rhs"},
+					Action: binary(func(a, b int) int { return a + b }),
 				},
 
 				{
-					Ops: "expr MINUS expr",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						// string to int
-						num1, valErr := tokenValue2Int(pvals[0].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num2, valErr := tokenValue2Int(pvals[2].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num := num1 - num2
-						return &Token {
-							Type: "NUMBER",
-							Value: fmt.Sprintf("%d", num),
-						}, nil
-					},
+					Ops: "lhs=expr MINUS rhs=expr",
+					Refs: []string{"lhs", "rhs"},
+					Action: binary(func(a, b int) int { return a - b }),
 				},
 
 				{
-					Ops: "expr MULTIPLY expr",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						// string to int
-						num1, valErr := tokenValue2Int(pvals[0].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num2, valErr := tokenValue2Int(pvals[2].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num := num1 * num2
-						return &Token {
-							Type: "NUMBER",
-							Value: fmt.Sprintf("%d", num),
-						}, nil
-					},
+					Ops: "lhs=expr MULTIPLY rhs=expr",
+					Refs: []string{"lhs", "rhs"},
+					Action: binary(func(a, b int) int { return a * b }),
 				},
 
 				{
-					Ops: "expr DIVIDE expr",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						// string to int
-						num1, valErr := tokenValue2Int(pvals[0].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num2, valErr := tokenValue2Int(pvals[2].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num := num1 / num2
-						return &Token {
-							Type: "NUMBER",
-							Value: fmt.Sprintf("%d", num),
-						}, nil
-					},
+					Ops: "lhs=expr DIVIDE rhs=expr",
+					Refs: []string{"lhs", "rhs"},
+					Action: binary(func(a, b int) int { return a / b }),
 				},
 
 				{
-					Ops: "MINUS expr %prec UMINUS",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						// string to int
-						num, valErr := tokenValue2Int(pvals[2].GetValue())
-						if valErr != nil {
-							return nil, valErr
-						}
-						num = -num
-						return &Token {
-							Type: "NUMBER",
-							Value: fmt.Sprintf("%d", num),
-						}, nil
+					Ops: "MINUS operand=expr %prec UMINUS",
+					Refs: []string{"operand"},
+					Action: func(ctx *ActionCtx[int]) (int, error) {
+						return -ctx.Val("operand"), nil
 					},
 				},
 
 				{
-					Ops: "LPAREN expr RPAREN",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						return pvals[1], nil
+					Ops: "LPAREN inner=expr RPAREN",
+					Refs: []string{"inner"},
+					Action: func(ctx *ActionCtx[int]) (int, error) {
+						return ctx.Val("inner"), nil
 					},
 				},
 
 				{
 					Ops: "NUMBER",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						return pvals[0], nil
+					RFunc: func(vals []Value[int]) (int, error) {
+						// string to int
+						return tokenValue2Int(vals[0].Token.Value)
 					},
 				},
 
 				{
 					Ops: "NAME",
-					RFunc: func(pvals []PValue) (PValue, error) {
-						value := string(pvals[0].GetValue())
+					RFunc: func(vals []Value[int]) (int, error) {
+						value := vals[0].Token.Value
 						num, ok := vars[value]
 						if !ok {
-							return nil, fmt.Errorf("undefined variable: %s", value)
+							return 0, fmt.Errorf("undefined variable: %s", value)
 						}
-						return &Token {
-							Type: "NUMBER",
-							Value: fmt.Sprintf("%d", num),
-						}, nil
+						return num, nil
 					},
 				},
 				
@@ -219,29 +152,23 @@ func createCalc() *calcParser {
 
 	return &calcParser{
 		vars: vars,
-		parser: CreateParser(symbols, ignores, rules, precedences),
+		parser: CreateParser(symbols, ignores, rules, precedences, opts...),
 	}
 }
 
 func (c *calcParser) parse(input string)  {
-	result, err := c.parser.Parse(input)
+	num, err := c.parser.Parse(input)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 	}
 
-	// string to int
-	num, valErr := tokenValue2Int(result.GetValue())
-	if valErr != nil {
-		fmt.Printf("Error: %v\n", valErr)
-	}
-
 	fmt.Printf("result is %d", num)
 }
 
-func tokenValue2Int(val []byte) (int, error) {
+func tokenValue2Int(val string) (int, error) {
 	// Use strconv.Atoi to convert the string to an integer.
 	// It returns the converted integer and a potential error.
-	num, err := strconv.Atoi(string(val))
+	num, err := strconv.Atoi(val)
 	if err != nil {
 		// Handle the error, for example, by returning 0 and the error.
 		return 0, fmt.Errorf("error converting string to int: %w", err)
@@ -255,4 +182,5 @@ func TestCalc(t *testing.T) {
 	calc.parse("a = 1 + 2")
 	calc.parse("b = a + 2")
 	calc.parse("a + b")
+	calc.parse("-(a - b) * 2")
 }
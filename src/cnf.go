@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The conversion to the Chomsky normal form, in the order which keeps the
+// grammar small: a start symbol which is in no right side, the terminals of
+// the long productions replaced by nonterminals, the productions split in
+// pairs, then the empty and the unit productions removed.
+func (c *cfgRules) chomskyNormalForm() {
+	from := len(c.steps)
+	c.cnfStart()
+	c.cnfTerminals()
+	c.cnfBinary()
+	c.removeEmptyProductions()
+	c.removeUnitProductions()
+	c.removeUnreachable()
+	for _, step := range c.steps[from:] {
+		step.Transform = ChomskyNormalForm
+	}
+}
+
+func (c *cfgRules) cnfStart() {
+	if !c.onRight(c.start) {
+		return
+	}
+	start := c.newName(c.start, "start")
+	c.names = append([]string{start}, c.names...)
+	c.alts[start] = [][]string{{c.start}}
+	c.step(ChomskyNormalForm, fmt.Sprintf("Add the start symbol %s", start), []string{}, start)
+	c.start = start
+}
+
+// A -> a B is replaced by A -> t_a B, t_a -> a
+func (c *cfgRules) cnfTerminals() {
+	nonterminals := make(map[string]string)
+	for _, a := range append([]string{}, c.names...) {
+		added := make([]string, 0)
+		replacedAny := false
+		alts := make([][]string, 0)
+		for _, alt := range c.alts[a] {
+			if len(alt) < 2 {
+				alts = append(alts, alt)
+				continue
+			}
+			replaced := make([]string, 0, len(alt))
+			for _, sym := range alt {
+				if c.isNonterminal(sym) {
+					replaced = append(replaced, sym)
+					continue
+				}
+				replacedAny = true
+				name, ok := nonterminals[sym]
+				if !ok {
+					name = c.newName("t", sym)
+					nonterminals[sym] = name
+					c.addAlt(name, []string{sym})
+					added = append(added, name)
+				}
+				replaced = append(replaced, name)
+			}
+			alts = append(alts, replaced)
+		}
+		if !replacedAny {
+			continue
+		}
+		before := c.productions(a)
+		c.setAlts(a, alts)
+		c.step(ChomskyNormalForm, fmt.Sprintf("Replace the terminals of %s", a), before, append([]string{a}, added...)...)
+	}
+}
+
+// A -> B C D is replaced by A -> B A_bin, A_bin -> C D
+func (c *cfgRules) cnfBinary() {
+	for _, a := range append([]string{}, c.names...) {
+		long := false
+		for _, alt := range c.alts[a] {
+			long = long || len(alt) > 2
+		}
+		if !long {
+			continue
+		}
+
+		before := c.productions(a)
+		added := make([]string, 0)
+		last := a
+		reserve := func() string {
+			name := c.newName(a, "bin")
+			c.alts[name] = [][]string{}
+			c.insertAfter(last, name)
+			last = name
+			added = append(added, name)
+			return name
+		}
+		alts := make([][]string, 0)
+		for _, alt := range c.alts[a] {
+			if len(alt) <= 2 {
+				alts = append(alts, alt)
+				continue
+			}
+			name := reserve()
+			alts = append(alts, []string{alt[0], name})
+			rest := alt[1:]
+			for len(rest) > 2 {
+				next := reserve()
+				c.addAlt(name, []string{rest[0], next})
+				name, rest = next, rest[1:]
+			}
+			c.addAlt(name, rest)
+		}
+		c.setAlts(a, alts)
+		c.step(ChomskyNormalForm, fmt.Sprintf("Split the long productions of %s", a), before, append([]string{a}, added...)...)
+	}
+}
+
+// Remove the nonterminals which can not be derived from the start symbol
+func (c *cfgRules) removeUnreachable() {
+	reached := map[string]bool{c.start: true}
+	queue := []string{c.start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, alt := range c.alts[name] {
+			for _, sym := range alt {
+				if c.isNonterminal(sym) && !reached[sym] {
+					reached[sym] = true
+					queue = append(queue, sym)
+				}
+			}
+		}
+	}
+
+	removed := make([]string, 0)
+	for _, name := range c.names {
+		if !reached[name] {
+			removed = append(removed, name)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	before := c.productions(removed...)
+	for _, name := range removed {
+		c.setAlts(name, nil)
+	}
+	c.step(ChomskyNormalForm, "Remove the unreachable nonterminals", before)
+}
+
+// A recognizer of any context-free grammar by the algorithm of Cocke, Younger
+// and Kasami, over the Chomsky normal form of the grammar. It reads the tokens
+// of the lexer, and tells which nonterminals derive each part of them.
+type CYKParser[T any] struct {
+	parser *Parser[T]
+	cnf    *Rewrite
+	start  string
+	// the order of the nonterminals in the cells
+	order map[string]int
+	// terminal: the nonterminals A -> terminal
+	unary map[string][]string
+	// B C: the nonterminals A -> B C
+	binary map[[2]string][]string
+	// whether the start symbol derives the empty string
+	empty bool
+}
+
+// The triangular table of CYK: Cells[l-1][i] has the nonterminals deriving the
+// l tokens from the i-th one, in the order of the Chomsky normal form.
+type CYKTable struct {
+	Tokens   []*Token
+	Cells    [][][]string
+	Accepted bool
+	start    string
+}
+
+// Create a CYK recognizer of the rules. The precedence only declares the
+// tokens, and the actions are not run.
+func CreateCYKParser[T any](lrules map[string]string, ignore []string, srules []*SyntaxRule[T], precedence []*Precedence) *CYKParser[T] {
+	lexer := CreateLexer(lrules, ignore)
+	grammar := defineGrammar(lexer, srules, precedence)
+	c := rulesOf(grammar)
+	c.apply(ChomskyNormalForm)
+
+	p := &CYKParser[T]{
+		parser: newParser[T](lexer, grammar, nil),
+		cnf: &Rewrite{
+			Rules:      c.syntaxRules(),
+			Steps:      c.steps,
+			transforms: []Transform{ChomskyNormalForm},
+		},
+		start:  c.start,
+		order:  make(map[string]int),
+		unary:  make(map[string][]string),
+		binary: make(map[[2]string][]string),
+	}
+	for i, name := range c.names {
+		p.order[name] = i
+		for _, alt := range c.alts[name] {
+			switch len(alt) {
+			case 0:
+				p.empty = true
+			case 1:
+				p.unary[alt[0]] = append(p.unary[alt[0]], name)
+			default:
+				pair := [2]string{alt[0], alt[1]}
+				p.binary[pair] = append(p.binary[pair], name)
+			}
+		}
+	}
+	return p
+}
+
+// The Chomsky normal form of the rules, with the steps of the conversion
+func (p *CYKParser[T]) CNF() *Rewrite {
+	return p.cnf
+}
+
+func (p *CYKParser[T]) Tokenize(s string) ([]*Token, error) {
+	return p.parser.Tokenize(s)
+}
+
+// Fill the CYK table of s. Only a failure of the lexer is an error, the table
+// tells whether s is accepted.
+func (p *CYKParser[T]) Recognize(s string) (*CYKTable, error) {
+	tokens, tokenErr := p.Tokenize(s)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return p.RecognizeToken(tokens), nil
+}
+
+func (p *CYKParser[T]) RecognizeToken(tokens []*Token) *CYKTable {
+	n := len(tokens)
+	table := &CYKTable{
+		Tokens: tokens,
+		Cells:  make([][][]string, n),
+		start:  p.start,
+	}
+	if n == 0 {
+		table.Accepted = p.empty
+		return table
+	}
+
+	sets := make([][]map[string]bool, n)
+	for l := 1; l <= n; l++ {
+		sets[l-1] = make([]map[string]bool, n-l+1)
+		for i := 0; i+l <= n; i++ {
+			set := make(map[string]bool)
+			if l == 1 {
+				for _, name := range p.unary[tokens[i].Type] {
+					set[name] = true
+				}
+			}
+			// the first k tokens derived by B, the others by C
+			for k := 1; k < l; k++ {
+				for b := range sets[k-1][i] {
+					for c := range sets[l-k-1][i+k] {
+						for _, name := range p.binary[[2]string{b, c}] {
+							set[name] = true
+						}
+					}
+				}
+			}
+			sets[l-1][i] = set
+		}
+	}
+
+	for l := range sets {
+		table.Cells[l] = make([][]string, len(sets[l]))
+		for i, set := range sets[l] {
+			cell := make([]string, 0, len(set))
+			for name := range set {
+				cell = append(cell, name)
+			}
+			sort.Slice(cell, func(x, y int) bool { return p.order[cell[x]] < p.order[cell[y]] })
+			table.Cells[l][i] = cell
+		}
+	}
+	table.Accepted = sets[n-1][0][p.start]
+	return table
+}
+
+// Write the lexer, the grammar and the conversion to the Chomsky normal form
+func (p *CYKParser[T]) WriteMDInfo(name string, path string) {
+	result := p.parser.lexMD()
+	result += p.parser.grammarMD()
+	result += p.cnf.MD()
+	writeMD(name, path, result)
+}
+
+// The table with the longest part of the tokens on top, so that the cells of
+// each row are above the tokens they derive
+func (t *CYKTable) MD() string {
+	n := len(t.Tokens)
+	result := "# CYK Table\n"
+	result += "\n"
+	if n > 0 {
+		result += "| Length |"
+		for _, token := range t.Tokens {
+			result += fmt.Sprintf(" %s %s |", token.Type, strings.ReplaceAll(token.Value, "|", "\\|"))
+		}
+		result += "\n| --- |"
+		for range t.Tokens {
+			result += " --- |"
+		}
+		result += "\n"
+		for l := n; l >= 1; l-- {
+			result += fmt.Sprintf("| %d |", l)
+			for i := 0; i < n; i++ {
+				cell := ""
+				if i < len(t.Cells[l-1]) {
+					cell = strings.Join(t.Cells[l-1][i], ", ")
+					if cell == "" {
+						cell = "∅"
+					}
+				}
+				result += fmt.Sprintf(" %s |", cell)
+			}
+			result += "\n"
+		}
+		result += "\n"
+	}
+
+	if t.Accepted {
+		result += fmt.Sprintf("The input is derived from %s.\n", t.start)
+	} else {
+		result += fmt.Sprintf("The input is not derived from %s.\n", t.start)
+	}
+	result += "\n"
+	return result
+}
+
+func (t *CYKTable) WriteMD(name string, path string) {
+	writeMD(name, path, t.MD())
+}
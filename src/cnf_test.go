@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// whether the rules are in Chomsky normal form: A -> B C, A -> a, and the
+// empty production of the start symbol only
+func isCNF(rules []*SyntaxRule[any]) bool {
+	nonterminals := make(map[string]bool)
+	for _, rule := range rules {
+		nonterminals[rule.Name] = true
+	}
+	for _, rule := range rules {
+		for _, ops := range rule.Expand {
+			alt := strings.Fields(ops.Ops)
+			switch len(alt) {
+			case 0:
+				if rule.Name != rules[0].Name {
+					return false
+				}
+			case 1:
+				if nonterminals[alt[0]] {
+					return false
+				}
+			case 2:
+				if !nonterminals[alt[0]] || !nonterminals[alt[1]] || alt[0] == rules[0].Name || alt[1] == rules[0].Name {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestChomskyNormalForm(t *testing.T) {
+	p := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	r := p.Rewrite(ChomskyNormalForm)
+	if !isCNF(r.Rules) {
+		t.Errorf("Expected the Chomsky normal form, got\n%s", strings.Join(ruleStrings(r.Rules), "\n"))
+	}
+	expectRules(t, r.Rules[:1], []string{
+		"expr_start -> expr expr_bin",
+		"expr_start -> term term_bin",
+		"expr_start -> NUMBER",
+		"expr_start -> t_LPAREN factor_bin",
+	})
+	titles := make([]string, 0)
+	for _, step := range r.Steps {
+		if step.Transform != ChomskyNormalForm {
+			t.Errorf("Unexpected transform %s of %s", step.Transform, step.Title)
+		}
+		titles = append(titles, step.Title)
+	}
+	for _, title := range []string{
+		"Add the start symbol expr_start",
+		"Replace the terminals of expr",
+		"Split the long productions of factor",
+		"Replace the unit productions of term",
+	} {
+		if !containsStr(titles, title) {
+			t.Errorf("Expected the step %s in %v", title, titles)
+		}
+	}
+
+	// a nullable start symbol keeps the empty string
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "LPAREN s RPAREN s"},
+				{Ops: ""},
+			},
+		},
+	}
+	e := CreateEarleyParser(earleySymbols, []string{" "}, rules, []*Precedence{})
+	r = e.Rewrite(ChomskyNormalForm)
+	if !isCNF(r.Rules) {
+		t.Errorf("Expected the Chomsky normal form, got\n%s", strings.Join(ruleStrings(r.Rules), "\n"))
+	}
+	expectRules(t, r.Rules[:1], []string{
+		"s_start -> <empty>",
+		"s_start -> t_LPAREN s_bin",
+	})
+}
+
+func TestCYK(t *testing.T) {
+	lr := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	p := CreateCYKParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	if !isCNF(p.CNF().Rules) {
+		t.Errorf("Expected the Chomsky normal form")
+	}
+
+	for _, s := range []string{"1", "1 + 2 * 3", "(1 + 2) * 3 + 4 * (5 + 6)", "1 + * 2", "(1 + 2", "1 2", ")"} {
+		_, err := lr.Parse(s)
+		table, cykErr := p.Recognize(s)
+		if cykErr != nil {
+			t.Fatal(cykErr)
+		}
+		if table.Accepted != (err == nil) {
+			t.Errorf("Expected %v for %s, got %v", err == nil, s, table.Accepted)
+		}
+	}
+
+	table, _ := p.Recognize("1 + 2 * 3")
+	if len(table.Cells) != 5 || len(table.Cells[4]) != 1 || len(table.Cells[0]) != 5 {
+		t.Fatalf("Expected a triangular table, got %v", table.Cells)
+	}
+	expected := map[[2]int]string{
+		{1, 0}: "expr_start, expr, term, factor",
+		{1, 1}: "t_PLUS",
+		{2, 0}: "",
+		{3, 2}: "expr_start, expr, term",
+		{5, 0}: "expr_start, expr",
+	}
+	for cell, e := range expected {
+		if got := strings.Join(table.Cells[cell[0]-1][cell[1]], ", "); got != e {
+			t.Errorf("Expected %s for %v, got %s", e, cell, got)
+		}
+	}
+
+	if table, _ := p.Recognize(""); table.Accepted {
+		t.Errorf("Expected the empty input to be rejected")
+	}
+}
+
+func TestCYKMD(t *testing.T) {
+	dir := t.TempDir()
+	p := CreateCYKParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	table, _ := p.Recognize("1 + 2")
+	table.WriteMD("cyk", dir)
+	p.WriteMDInfo("cnf", dir)
+
+	content, err := os.ReadFile(filepath.Join(dir, "cyk.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(content)
+	for _, s := range []string{
+		"# CYK Table",
+		"| Length | NUMBER 1 | PLUS + | NUMBER 2 |",
+		"| 3 | expr_start, expr |  |  |\n| 2 | ∅ | expr_bin |  |\n",
+		"The input is derived from expr_start.",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("Expected %s in\n%s", s, md)
+		}
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, "cnf.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md = string(content)
+	for _, s := range []string{
+		"# Grammar\n",
+		"## Chomsky Normal Form\n\n### Add the start symbol expr_start\n\nAfter:\n\n- expr_start -> expr\n",
+		"- t_PLUS -> PLUS\n",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("Expected %s in\n%s", s, md)
+		}
+	}
+}
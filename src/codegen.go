@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenerateParser emits the Go source of a standalone parser of the grammar,
+// which only needs the standard library:
+//
+//   - the regexps of the lexer and Tokenize
+//   - the compressed LR tables of the parser
+//   - a Parser whose ParseToken runs the same driver as the one of goblin
+//
+// The actions of the rules are Go functions, so they can not be generated.
+// They are hooked with SetAction by the production they reduce, e.g.
+// "expr -> expr PLUS expr", and the productions without an action build
+// the nodes of the concrete syntax tree.
+func (p *Parser[T]) GenerateParser(pkg string) ([]byte, error) {
+	source := p.emitParser(pkg)
+	formatted, fmtErr := format.Source([]byte(source))
+	if fmtErr != nil {
+		return nil, fmt.Errorf("generated parser is invalid: %v", fmtErr)
+	}
+	return formatted, nil
+}
+
+func (p *Parser[T]) emitParser(pkg string) string {
+	t := p.table.tables
+	result := "// Code generated by goblin GenerateParser. DO NOT EDIT.\n\n"
+	result += fmt.Sprintf("package %s\n\n", pkg)
+	result += genRuntime
+
+	// lexer
+	result += "var (\n"
+	result += fmt.Sprintf("lexPattern = regexp.MustCompile(%s)\n", strconv.Quote(p.lexer.pattern.String()))
+	result += fmt.Sprintf("lexIgnore = regexp.MustCompile(%s)\n", strconv.Quote(p.lexer.ignore.String()))
+	result += ")\n\n"
+	result += "// the keywords of each token type\n"
+	result += "var lexKeywords = map[string]map[string]string{\n"
+	for _, tokenType := range genSortedKeys(p.lexer.redefine) {
+		result += fmt.Sprintf("%s: {\n", strconv.Quote(tokenType))
+		keywords := p.lexer.redefine[tokenType]
+		for _, value := range genSortedKeys(keywords) {
+			result += fmt.Sprintf("%s: %s,\n", strconv.Quote(value), strconv.Quote(keywords[value]))
+		}
+		result += "},\n"
+	}
+	result += "}\n\n"
+
+	// productions
+	result += "// Productions lists the productions by their numbers.\n"
+	result += "var Productions = []string{\n"
+	for _, prod := range p.grammar.productions {
+		result += fmt.Sprintf("%s,\n", strconv.Quote(productionString(prod)))
+	}
+	result += "}\n\n"
+	names := make([]string, 0, len(p.grammar.productions))
+	symbols := make([]string, 0, len(p.grammar.productions))
+	midDepths := make([]int32, 0, len(p.grammar.productions))
+	for _, prod := range p.grammar.productions {
+		names = append(names, strconv.Quote(prod.name))
+		quoted := make([]string, 0, len(prod.prod))
+		for _, sym := range prod.prod {
+			quoted = append(quoted, strconv.Quote(sym))
+		}
+		symbols = append(symbols, "{"+strings.Join(quoted, ", ")+"}")
+		midDepths = append(midDepths, int32(prod.midDepth))
+	}
+	result += fmt.Sprintf("var prodNames = []string{\n%s,\n}\n\n", genWrap(names))
+	result += fmt.Sprintf("var prodSymbols = [][]string{\n%s,\n}\n\n", genWrap(symbols))
+	result += genInts("prodMidDepth", midDepths)
+	result += genInts("prodLen", t.rhsLen)
+	result += genInts("prodLhs", t.lhs)
+
+	// tables
+	terms := make([]string, len(t.terminals))
+	for term, i := range t.terminals {
+		terms[i] = strconv.Quote(term)
+	}
+	result += "// the numbers of the terminals\n"
+	result += "var terminals = map[string]int{\n"
+	for i, term := range terms {
+		result += fmt.Sprintf("%s: %d,\n", term, i)
+	}
+	result += "}\n\n"
+	for _, c := range []struct {
+		name string
+		comb *combVector
+	}{{"action", t.action}, {"goto", t.gotos}} {
+		result += genInts(c.name+"Default", c.comb.defaults)
+		result += genInts(c.name+"Base", c.comb.base)
+		result += genInts(c.name+"Next", c.comb.next)
+		result += genInts(c.name+"Check", c.comb.check)
+	}
+	return result
+}
+
+func productionString(prod *production) string {
+	if len(prod.prod) == 0 {
+		return fmt.Sprintf("%s -> %s", prod.name, EMPTYTOKEN)
+	}
+	return fmt.Sprintf("%s -> %s", prod.name, strings.Join(prod.prod, " "))
+}
+
+func genSortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// join the items, a few on each line
+func genWrap(items []string) string {
+	lines := make([]string, 0)
+	for i := 0; i < len(items); i += 12 {
+		end := min(i+12, len(items))
+		lines = append(lines, strings.Join(items[i:end], ", "))
+	}
+	return strings.Join(lines, ",\n")
+}
+
+func genInts(name string, values []int32) string {
+	items := make([]string, 0, len(values))
+	for _, v := range values {
+		items = append(items, strconv.Itoa(int(v)))
+	}
+	if len(items) == 0 {
+		return fmt.Sprintf("var %s = []int32{}\n\n", name)
+	}
+	return fmt.Sprintf("var %s = []int32{\n%s,\n}\n\n", name, genWrap(items))
+}
+
+// the lexer and the driver of the generated parser, whose tables follow
+const genRuntime = `import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Token is a token of the input.
+type Token struct {
+	Type   string
+	Value  string
+	Lineno int
+	Index  int
+	End    int
+}
+
+// Node is a node of the concrete syntax tree. An inner node is the reduction
+// of the production numbered Production, a leaf holds a Token or the value of
+// an action.
+type Node struct {
+	Rule       string
+	Production int
+	Children   []*Node
+	Token      *Token
+	Value      any
+}
+
+// Value is a value on the stack of the parser: the Token of a terminal, the
+// Val returned by the action of a nonterminal, or its Node if its
+// production has no action.
+type Value struct {
+	Token *Token
+	Val   any
+	Node  *Node
+}
+
+// Action computes the value of a production from the values of its symbols.
+type Action func(vals []Value) (any, error)
+
+// Parser runs the LR tables with the actions hooked by SetAction.
+type Parser struct {
+	actions []Action
+}
+
+func NewParser() *Parser {
+	return &Parser{actions: make([]Action, len(Productions))}
+}
+
+// SetAction hooks the action of the production, e.g. "expr -> expr PLUS expr".
+func (p *Parser) SetAction(production string, action Action) error {
+	for i, prod := range Productions {
+		if prod == production {
+			p.actions[i] = action
+			return nil
+		}
+	}
+	return fmt.Errorf("no production %s", production)
+}
+
+// Tokenize splits the text into tokens.
+func Tokenize(text string) ([]*Token, error) {
+	tokens := []*Token{}
+	lineno := 1
+	index := 0
+
+	for index < len(text) {
+		if lexIgnore.MatchString(text[index : index+1]) {
+			index++
+			continue
+		}
+		if text[index] == '\n' {
+			lineno++
+			index++
+			continue
+		}
+
+		match := lexPattern.FindStringSubmatch(text[index:])
+		if match == nil {
+			return nil, fmt.Errorf("invalid token at index %d, line %d", index, lineno)
+		}
+
+		token := &Token{}
+		longestLen := 0
+		for i, name := range lexPattern.SubexpNames() {
+			if i != 0 && name != "" && len(match[i]) > 0 {
+				token.Type = name
+				token.Value = match[i]
+				token.Index = index
+				token.End = index + len(match[i])
+				token.Lineno = lineno
+				if len(match[i]) > longestLen {
+					longestLen = len(match[i])
+				}
+			}
+		}
+		if keyword, ok := lexKeywords[token.Type][token.Value]; ok {
+			token.Type = keyword
+		}
+
+		index += longestLen
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Parse tokenizes and parses s.
+func (p *Parser) Parse(s string) (Value, error) {
+	tokens, err := Tokenize(s)
+	if err != nil {
+		return Value{}, err
+	}
+	return p.ParseToken(tokens)
+}
+
+func combGet(defaults, base, next, check []int32, row int, col int) int32 {
+	i := int(base[row]) + col
+	if i < len(check) && int(check[i]) == row {
+		return next[i]
+	}
+	return defaults[row]
+}
+
+// ParseToken parses the tokens. A positive action shifts to the state
+// action-1, a negative one reduces the production -action-1, and the
+// reduction of the production 0 accepts.
+func (p *Parser) ParseToken(tokens []*Token) (Value, error) {
+	endToken := &Token{Type: "$end"}
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		endToken.Index = last.End
+		endToken.End = last.End
+		endToken.Lineno = last.Lineno
+	}
+	tokens = append(tokens, endToken)
+	terms := make([]int, len(tokens))
+	for i, token := range tokens {
+		term, ok := terminals[token.Type]
+		if !ok {
+			term = -1
+		}
+		terms[i] = term
+	}
+
+	current := 0
+	state := 0
+	stateStack := []int{0}
+	valStack := []Value{{Token: endToken}}
+	for {
+		token := tokens[current]
+		var action int32
+		if terms[current] >= 0 {
+			action = combGet(actionDefault, actionBase, actionNext, actionCheck, state, terms[current])
+		}
+
+		switch {
+		case action == 0:
+			return Value{}, fmt.Errorf("syntax error at line %d, token %s %s", token.Lineno, token.Type, token.Value)
+		case action > 0:
+			state = int(action - 1)
+			if token != endToken {
+				stateStack = append(stateStack, state)
+				valStack = append(valStack, Value{Token: token})
+				current++
+			}
+		case action == -1:
+			return valStack[len(valStack)-1], nil
+		default:
+			prod := int(-action - 1)
+			size := int(prodLen[prod])
+			vals := valStack[len(valStack)-size:]
+			valStack = valStack[:len(valStack)-size]
+
+			var returned Value
+			if p.actions[prod] == nil {
+				returned = Value{Node: createNode(prod, vals)}
+			} else {
+				if depth := int(prodMidDepth[prod]); depth > 0 {
+					vals = valStack[len(valStack)-depth:]
+				}
+				val, err := p.actions[prod](vals)
+				if err != nil {
+					return Value{}, fmt.Errorf("Semantics Error: %s, line %d", err.Error(), token.Lineno)
+				}
+				returned = Value{Val: val}
+			}
+			valStack = append(valStack, returned)
+
+			stateStack = stateStack[:len(stateStack)-size]
+			state = int(combGet(gotoDefault, gotoBase, gotoNext, gotoCheck, int(prodLhs[prod]), stateStack[len(stateStack)-1]))
+			if state < 0 {
+				return Value{}, fmt.Errorf("syntax error at line %d, token %s %s", token.Lineno, token.Type, token.Value)
+			}
+			stateStack = append(stateStack, state)
+		}
+	}
+}
+
+func createNode(prod int, vals []Value) *Node {
+	node := &Node{
+		Rule:       prodNames[prod],
+		Production: prod,
+		Children:   make([]*Node, 0, len(vals)),
+	}
+	for i, v := range vals {
+		// the hidden nonterminals of the mid-rule actions are not in the tree
+		sym := prodSymbols[prod][i]
+		if strings.HasPrefix(sym, "$@") {
+			continue
+		}
+		switch {
+		case v.Node != nil:
+			node.Children = append(node.Children, v.Node)
+		case v.Token != nil:
+			node.Children = append(node.Children, &Node{Rule: v.Token.Type, Production: -1, Token: v.Token})
+		default:
+			node.Children = append(node.Children, &Node{Rule: sym, Production: -1, Value: v.Val})
+		}
+	}
+	return node
+}
+
+// String prints the tree in s-expression, e.g. (expr (expr NUMBER:1) PLUS:+ (expr NUMBER:2))
+func (n *Node) String() string {
+	if n.Token != nil {
+		return fmt.Sprintf("%s:%s", n.Rule, n.Token.Value)
+	}
+	if n.Production < 0 && n.Children == nil {
+		return fmt.Sprintf("%s:%v", n.Rule, n.Value)
+	}
+	children := make([]string, 0)
+	for _, child := range n.Children {
+		children = append(children, child.String())
+	}
+	if len(children) == 0 {
+		return fmt.Sprintf("(%s)", n.Rule)
+	}
+	return fmt.Sprintf("(%s %s)", n.Rule, strings.Join(children, " "))
+}
+
+`
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateParser(t *testing.T) {
+	source, err := createCalc().parser.GenerateParser("calc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package calc",
+		`"expr -> expr PLUS expr",`,
+		"var actionCheck = []int32{",
+		"func (p *Parser) ParseToken(tokens []*Token) (Value, error)",
+	} {
+		if !strings.Contains(string(source), want) {
+			t.Errorf("Expected %s in the generated parser", want)
+		}
+	}
+	// only the runtime is generated
+	if strings.Contains(string(source), "lrTable") {
+		t.Errorf("Unexpected table construction in the generated parser")
+	}
+}
+
+func TestGeneratedParserRuns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip building the generated code in short mode")
+	}
+	goBin, lookErr := exec.LookPath("go")
+	if lookErr != nil {
+		t.Skip("go is not available")
+	}
+
+	p := createCalc().parser
+	source, err := p.GenerateParser("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "(1 + 2) * -3 - x / 4"
+	tree, err := p.ParseTree(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the generated file alone, with the actions of a sum hooked
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "parser_gen.go"), source, 0644)
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module calc\n\ngo 1.21\n"), 0644)
+	main := `package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func main() {
+	p := NewParser()
+	tree, err := p.Parse(` + "`" + input + "`" + `)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(tree.Node)
+
+	p.SetAction("expr -> NUMBER", func(vals []Value) (any, error) {
+		return strconv.Atoi(vals[0].Token.Value)
+	})
+	p.SetAction("expr -> expr PLUS expr", func(vals []Value) (any, error) {
+		return vals[0].Val.(int) + vals[2].Val.(int), nil
+	})
+	p.SetAction("statement -> expr", func(vals []Value) (any, error) {
+		return vals[0].Val, nil
+	})
+	sum, err := p.Parse("1 + 2 + 3")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(sum.Val)
+
+	if err := p.SetAction("expr -> expr", nil); err == nil {
+		panic("expected an error for an unknown production")
+	}
+	if _, err := p.Parse("1 +"); err == nil {
+		panic("expected a syntax error")
+	}
+}
+`
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0644)
+
+	cmd := exec.Command(goBin, "run", ".")
+	cmd.Dir = dir
+	out, runErr := cmd.CombinedOutput()
+	if runErr != nil {
+		t.Fatalf("generated parser failed: %v\n%s", runErr, out)
+	}
+	want := tree.String() + "\n6\n"
+	if string(out) != want {
+		t.Errorf("Expected %q, got %q", want, string(out))
+	}
+}
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type ConflictKind int
+
+const (
+	ShiftReduce ConflictKind = iota
+	ReduceReduce
+)
+
+func (k ConflictKind) String() string {
+	if k == ShiftReduce {
+		return "shift/reduce"
+	}
+	return "reduce/reduce"
+}
+
+// A conflict of the LR table, between a shift and a reduce or two reduces on
+// the same lookahead. A shift/reduce conflict is resolved by the precedence
+// if any, and shift is favored otherwise. A reduce/reduce conflict is
+// resolved in favor of the production defined first.
+type Conflict struct {
+	Kind      ConflictKind
+	State     int
+	Lookahead string
+	// the shift item and the reduce item, or the two reduce items
+	Items [2]string
+	// the action taken, e.g. "shift" or "reduce expr -> expr PLUS expr"
+	Resolution   string
+	ByPrecedence bool
+	// nil if no counterexample is found
+	Counterexample *Counterexample
+}
+
+// A sentential form showing the conflict, with a dot at the lookahead. A
+// unifying counterexample is one sentential form with two derivations, i.e.
+// the grammar is ambiguous. Otherwise the counterexample is a sentential form
+// for each of the items, with its derivation.
+type Counterexample struct {
+	Unifying    bool
+	Examples    [2]string
+	Derivations [2]string
+}
+
+func (c *Conflict) String() string {
+	return fmt.Sprintf("%s conflict in state %d on %s between %s and %s, resolved as %s",
+		c.Kind, c.State, c.Lookahead, c.Items[0], c.Items[1], c.Resolution)
+}
+
+// The conflicts of the table of the parser, with their counterexamples
+func (p *Parser[T]) Conflicts() []*Conflict {
+	g := p.grammar
+	table := p.lrStates()
+	result := make([]*Conflict, 0, len(table.conflicts))
+	for _, c := range table.conflicts {
+		resolution := "shift"
+		if (c.winner.lrIndex + 1) == c.winner.len {
+			resolution = "reduce " + strings.TrimSuffix(g.itemOrigin(c.winner), " .")
+		}
+		result = append(result, &Conflict{
+			Kind:           c.kind,
+			State:          c.state,
+			Lookahead:      c.lookahead,
+			Items:          [2]string{g.itemOrigin(c.items[0]), g.itemOrigin(c.items[1])},
+			Resolution:     resolution,
+			ByPrecedence:   c.byPrecedence,
+			Counterexample: table.counterexample(c),
+		})
+	}
+	return result
+}
+
+type conflict struct {
+	kind      ConflictKind
+	state     int
+	lookahead string
+	// the shift item and the reduce item, or the two reduce items
+	items        [2]*LRItem
+	winner       *LRItem
+	byPrecedence bool
+}
+
+// Record the conflict between the items on lookahead in state, which is
+// resolved in favor of winner. A shift/reduce conflict is recorded once for
+// each reduce item on the lookahead, whichever shift item comes with it.
+func (self *lrTable) addConflict(conflicts []*conflict, state int, lookahead string, first *LRItem, second *LRItem, winner *LRItem) []*conflict {
+	g := self.grammar
+	kind := ReduceReduce
+	if (first.lrIndex + 1) != first.len {
+		kind = ShiftReduce
+	}
+
+	for _, c := range conflicts {
+		if c.state != state || c.lookahead != lookahead || c.kind != kind {
+			continue
+		}
+		if c.items[1] == second && (kind == ShiftReduce || c.items[0] == first) {
+			return conflicts
+		}
+	}
+
+	return append(conflicts, &conflict{
+		kind:      kind,
+		state:     state,
+		lookahead: lookahead,
+		items:     [2]*LRItem{first, second},
+		winner:    winner,
+		byPrecedence: kind == ShiftReduce &&
+			g.precedence[lookahead] > 0 && g.productions[second.number].precLevel > 0,
+	})
+}
+
+func (self *lrTable) sortConflicts() {
+	sort.SliceStable(self.conflicts, func(i, j int) bool {
+		a, b := self.conflicts[i], self.conflicts[j]
+		if a.state != b.state {
+			return a.state < b.state
+		}
+		return a.lookahead < b.lookahead
+	})
+}
+
+// count the shift/reduce and the reduce/reduce conflicts
+func (self *lrTable) countConflicts() (int, int) {
+	sr, rr := 0, 0
+	for _, c := range self.conflicts {
+		if c.kind == ShiftReduce {
+			sr++
+		} else {
+			rr++
+		}
+	}
+	return sr, rr
+}
+
+// The number of conflicts expected in the grammar, e.g. the dangling else.
+// With an Expect option, the creation of the parser fails unless the numbers
+// of the shift/reduce and the reduce/reduce conflicts not resolved by the
+// precedence are exactly the expected ones.
+type Expect struct {
+	ShiftReduce  int
+	ReduceReduce int
+}
+
+func (e Expect) apply(c *parserConfig) {
+	c.expect = &e
+}
+
+// the conflicts which are not resolved by the precedence
+func (self *lrTable) unresolvedConflicts() []*conflict {
+	result := make([]*conflict, 0)
+	for _, c := range self.conflicts {
+		if !c.byPrecedence {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Warn about the conflicts which are not resolved by the precedence, or panic
+// if they are not the expected ones.
+func (self *lrTable) checkConflicts(expect *Expect) {
+	g := self.grammar
+	unresolved := self.unresolvedConflicts()
+	sr, rr := 0, 0
+	for _, c := range unresolved {
+		if c.kind == ShiftReduce {
+			sr++
+		} else {
+			rr++
+		}
+	}
+
+	if expect == nil {
+		if sr > 0 || rr > 0 {
+			fmt.Printf("%d shift/reduce and %d reduce/reduce conflict(s) !! \n", sr, rr)
+		}
+		return
+	}
+	if sr == expect.ShiftReduce && rr == expect.ReduceReduce {
+		return
+	}
+
+	msg := fmt.Sprintf("expected %d shift/reduce and %d reduce/reduce conflict(s), found %d and %d:",
+		expect.ShiftReduce, expect.ReduceReduce, sr, rr)
+	for _, c := range unresolved {
+		msg += fmt.Sprintf("\n%s conflict in state %d on %s between %s and %s",
+			c.kind, c.state, c.lookahead, g.itemOrigin(c.items[0]), g.itemOrigin(c.items[1]))
+	}
+	panic(msg)
+}
+
+// Describe the conflict without its state, so that the conflicts of tables
+// built by different methods can be matched. The shift item is left out since
+// any item with the lookahead after the dot can come with the conflict.
+func (c *conflict) key() string {
+	if c.kind == ShiftReduce {
+		return fmt.Sprintf("shift/reduce on %s with %s", c.lookahead, c.items[1].String())
+	}
+	first, second := c.items[0].String(), c.items[1].String()
+	if first > second {
+		first, second = second, first
+	}
+	return fmt.Sprintf("reduce/reduce on %s between %s and %s", c.lookahead, first, second)
+}
+
+// bounds of the search of the counterexamples
+const (
+	maxConflictPaths     = 20
+	maxConflictPathExtra = 4
+	maxSearchNodes       = 20000
+	maxCompletionDepth   = 12
+)
+
+// Search a counterexample of the conflict. The prefixes are the shortest
+// paths of symbols from the start state to the state of the conflict. Each
+// prefix is completed by the shortest symbols after each of the items, which
+// start with the lookahead. The first sentential form with a derivation
+// applying each of the items at the dot is a unifying counterexample, as
+// another ambiguity of the sentence says nothing of the conflict. Otherwise
+// the first completion of each item with a derivation applying it at the
+// dot, whatever its prefix, makes a nonunifying one, since the conflicts of
+// the merged LALR(1) states have no common prefix.
+func (self *lrTable) counterexample(c *conflict) *Counterexample {
+	// the reduce item of each branch, nil for the shift
+	branches := [2]*LRItem{nil, c.items[1]}
+	// the items applied at the dot in each branch, any shift of the lookahead
+	items := [2][]*LRItem{self.shiftItems(c.state, c.lookahead), {c.items[1]}}
+	if c.kind == ReduceReduce {
+		branches[0] = c.items[0]
+		items[0] = []*LRItem{c.items[0]}
+	}
+
+	nonunifying := &Counterexample{}
+	found := [2]bool{}
+	for _, path := range self.conflictPaths(c.state) {
+		stack := []int{0}
+		for _, sym := range path {
+			stack = append(stack, self.transitions[stack[len(stack)-1]][sym])
+		}
+
+		for i, reduce := range branches {
+			rest := self.completion(stack, c.lookahead, reduce)
+			if rest == nil {
+				continue
+			}
+			sentence := append(append([]string{}, path...), rest...)
+			derivations := [2]*derivation{}
+			for k := range items {
+				derivations[k] = self.grammar.deriveItems(sentence, items[k], len(path))
+			}
+			example := dotSentence(sentence, len(path))
+			if derivations[0] != nil && derivations[1] != nil {
+				return &Counterexample{
+					Unifying: true,
+					Examples: [2]string{example, example},
+					Derivations: [2]string{
+						derivations[0].format(len(path)),
+						derivations[1].format(len(path)),
+					},
+				}
+			}
+			if !found[i] && derivations[i] != nil {
+				found[i] = true
+				nonunifying.Examples[i] = example
+				nonunifying.Derivations[i] = derivations[i].format(len(path))
+			}
+		}
+	}
+
+	if found[0] && found[1] {
+		return nonunifying
+	}
+	return nil
+}
+
+// the items of state shifting the lookahead
+func (self *lrTable) shiftItems(state int, lookahead string) []*LRItem {
+	result := make([]*LRItem, 0)
+	for _, item := range self.closures[state] {
+		if (item.lrIndex+1) != item.len && (*item.prod)[item.lrIndex+1] == lookahead {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// The paths of symbols from the start state to state, the shortest first and
+// at most maxConflictPathExtra symbols longer than the shortest one.
+func (self *lrTable) conflictPaths(state int) [][]string {
+	type node struct {
+		state int
+		path  []string
+	}
+
+	paths := make([][]string, 0)
+	queue := []*node{{state: 0, path: []string{}}}
+	shortest := -1
+	for n := 0; len(queue) > 0 && n < maxSearchNodes && len(paths) < maxConflictPaths; n++ {
+		current := queue[0]
+		queue = queue[1:]
+		if shortest >= 0 && len(current.path) > shortest+maxConflictPathExtra {
+			break
+		}
+		if current.state == state {
+			if shortest < 0 {
+				shortest = len(current.path)
+			}
+			paths = append(paths, current.path)
+		}
+
+		for _, sym := range self.transitionSymbols(current.state) {
+			if sym == ENDTOKEN {
+				continue
+			}
+			path := append(append([]string{}, current.path...), sym)
+			queue = append(queue, &node{state: self.transitions[current.state][sym], path: path})
+		}
+	}
+	return paths
+}
+
+// The shortest symbols which complete the stack of states up to the end of
+// the input, starting with the lookahead, after the reduction of the item if
+// it is not nil. The reductions of the complete items are made regardless of
+// the lookaheads. Returns nil if there is none.
+func (self *lrTable) completion(stack []int, lookahead string, reduce *LRItem) []string {
+	g := self.grammar
+	reduceStack := func(stack []int, number int) []int {
+		prod := g.productions[number]
+		if len(stack) <= prod.prodSize {
+			return nil
+		}
+		rest := stack[:len(stack)-prod.prodSize]
+		next, ok := self.transitions[rest[len(rest)-1]][prod.name]
+		if !ok {
+			return nil
+		}
+		return append(append([]int{}, rest...), next)
+	}
+
+	if reduce != nil {
+		stack = reduceStack(stack, reduce.number)
+		if stack == nil {
+			return nil
+		}
+	}
+
+	type node struct {
+		stack []int
+		syms  []string
+	}
+	accepted := func(stack []int) bool {
+		if len(stack) != 2 {
+			return false
+		}
+		_, ok := self.transitions[stack[1]][ENDTOKEN]
+		return ok
+	}
+
+	// 0-1 breadth first search, the reductions cost nothing
+	depth := len(stack) + maxCompletionDepth
+	visited := createSet()
+	queue := []*node{{stack: stack, syms: []string{}}}
+	for n := 0; len(queue) > 0 && n < maxSearchNodes; n++ {
+		current := queue[0]
+		queue = queue[1:]
+		if len(current.syms) > 0 && accepted(current.stack) {
+			return current.syms
+		}
+
+		key := fmt.Sprint(current.stack, len(current.syms) > 0)
+		if visited.contains(key) {
+			continue
+		}
+		visited.add(key)
+
+		top := current.stack[len(current.stack)-1]
+		for _, item := range self.closures[top] {
+			if (item.lrIndex+1) != item.len || item.name == "S'" {
+				continue
+			}
+			if next := reduceStack(current.stack, item.number); next != nil {
+				queue = append([]*node{{stack: next, syms: current.syms}}, queue...)
+			}
+		}
+
+		if len(current.stack) >= depth {
+			continue
+		}
+		for _, sym := range self.transitionSymbols(top) {
+			if sym == ENDTOKEN || (len(current.syms) == 0 && sym != lookahead) {
+				continue
+			}
+			queue = append(queue, &node{
+				stack: append(append([]int{}, current.stack...), self.transitions[top][sym]),
+				syms:  append(append([]string{}, current.syms...), sym),
+			})
+		}
+	}
+	return nil
+}
+
+// The symbols of the transitions of state, the nonterminals first so that
+// the counterexamples are short sentential forms
+func (self *lrTable) transitionSymbols(state int) []string {
+	syms := make([]string, 0, len(self.transitions[state]))
+	for sym := range self.transitions[state] {
+		syms = append(syms, sym)
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		_, a := self.grammar.nonterminals[syms[i]]
+		_, b := self.grammar.nonterminals[syms[j]]
+		if a != b {
+			return a
+		}
+		return syms[i] < syms[j]
+	})
+	return syms
+}
+
+func dotSentence(sentence []string, dot int) string {
+	syms := append(append([]string{}, sentence[:dot]...), ".")
+	return strings.Join(append(syms, sentence[dot:]...), " ")
+}
+
+// A derivation of symbols of a sentential form, prod is nil for a symbol of
+// the sentential form itself.
+type derivation struct {
+	sym      string
+	prod     *production
+	children []*derivation
+}
+
+// Format as sym -> [ children ], with a dot before the symbol at position dot
+// of the sentential form.
+func (d *derivation) format(dot int) string {
+	pos := 0
+	var format func(d *derivation) string
+	format = func(d *derivation) string {
+		if d.prod == nil {
+			s := d.sym
+			if pos == dot {
+				s = ". " + s
+			}
+			pos++
+			return s
+		}
+		children := make([]string, 0, len(d.children))
+		for _, child := range d.children {
+			children = append(children, format(child))
+		}
+		return fmt.Sprintf("%s -> [ %s ]", d.sym, strings.Join(children, " "))
+	}
+
+	result := format(d)
+	if pos == dot {
+		result += " ."
+	}
+	return result
+}
+
+// At most two derivations of the sentential form from the start rule
+func (g *grammar) derive(sentence []string) []*derivation {
+	d := &deriver{
+		g:      g,
+		w:      sentence,
+		memo:   make(map[string][]*derivation),
+		active: createSet(),
+	}
+	return d.derive(g.productions[0].prod[0], 0, len(sentence))
+}
+
+// A derivation of the sentential form applying one of the items at the dot:
+// the symbols before the dot of the item are the ones just before the dot of
+// the sentential form, and its production derives the rest from there. The
+// node of the item takes the place of its symbol in a derivation of the
+// sentential form reduced by it.
+func (g *grammar) deriveItems(sentence []string, items []*LRItem, dot int) *derivation {
+	d := &deriver{
+		g:      g,
+		w:      sentence,
+		memo:   make(map[string][]*derivation),
+		active: createSet(),
+	}
+	for _, item := range items {
+		prod := g.productions[item.number]
+		start := dot - item.lrIndex
+		if start < 0 || !slices.Equal(sentence[start:dot], prod.prod[:item.lrIndex]) {
+			continue
+		}
+		before := make([]*derivation, 0, item.lrIndex)
+		for _, sym := range prod.prod[:item.lrIndex] {
+			before = append(before, &derivation{sym: sym})
+		}
+
+		for end := dot; end <= len(sentence); end++ {
+			rests := d.deriveSeq(prod.prod[item.lrIndex:], dot, end)
+			if len(rests) == 0 {
+				continue
+			}
+			reduced := append(append(append([]string{}, sentence[:start]...), prod.name), sentence[end:]...)
+			outers := g.derive(reduced)
+			if len(outers) == 0 {
+				continue
+			}
+			node := &derivation{
+				sym:      prod.name,
+				prod:     prod,
+				children: append(append([]*derivation{}, before...), rests[0]...),
+			}
+			return outers[0].replace(start, node)
+		}
+	}
+	return nil
+}
+
+// a copy of the derivation with node in place of the symbol at position pos
+// of the sentential form
+func (d *derivation) replace(pos int, node *derivation) *derivation {
+	n := 0
+	var replace func(d *derivation) *derivation
+	replace = func(d *derivation) *derivation {
+		if d.prod == nil {
+			n++
+			if n-1 == pos {
+				return node
+			}
+			return d
+		}
+		children := make([]*derivation, 0, len(d.children))
+		for _, child := range d.children {
+			children = append(children, replace(child))
+		}
+		return &derivation{sym: d.sym, prod: d.prod, children: children}
+	}
+	return replace(d)
+}
+
+// Derive the spans of a sentential form by memoized recursion. A derivation
+// going back to the span it derives, through unit or empty productions, is
+// cut.
+type deriver struct {
+	g      *grammar
+	w      []string
+	memo   map[string][]*derivation
+	active *StrSet
+}
+
+func (d *deriver) derive(sym string, i int, j int) []*derivation {
+	key := fmt.Sprintf("%s/%d/%d", sym, i, j)
+	if result, ok := d.memo[key]; ok {
+		return result
+	}
+	if d.active.contains(key) {
+		return nil
+	}
+	d.active.add(key)
+
+	result := make([]*derivation, 0, 2)
+	if j == i+1 && d.w[i] == sym {
+		result = append(result, &derivation{sym: sym})
+	}
+	for _, p := range d.g.prodNames[sym] {
+		for _, children := range d.deriveSeq(p.prod, i, j) {
+			if len(result) == 2 {
+				break
+			}
+			result = append(result, &derivation{sym: sym, prod: p, children: children})
+		}
+	}
+
+	d.active.remove(key)
+	d.memo[key] = result
+	return result
+}
+
+// at most two derivations of w[i:j] from the symbols
+func (d *deriver) deriveSeq(syms []string, i int, j int) [][]*derivation {
+	if len(syms) == 0 {
+		if i == j {
+			return [][]*derivation{{}}
+		}
+		return nil
+	}
+
+	result := make([][]*derivation, 0, 2)
+	for k := i; k <= j && len(result) < 2; k++ {
+		firsts := d.derive(syms[0], i, k)
+		if len(firsts) == 0 {
+			continue
+		}
+		rests := d.deriveSeq(syms[1:], k, j)
+		for _, first := range firsts {
+			for _, rest := range rests {
+				if len(result) == 2 {
+					break
+				}
+				result = append(result, append([]*derivation{first}, rest...))
+			}
+		}
+	}
+	return result
+}
+
+// The conflicts with their resolutions and counterexamples, for WriteMDInfo
+func (p *Parser[T]) conflictsMD() string {
+	conflicts := p.Conflicts()
+	if len(conflicts) == 0 {
+		return ""
+	}
+
+	result := "# Conflicts\n"
+	result += "\n"
+	for _, c := range conflicts {
+		result += fmt.Sprintf("## %s conflict in [S%d](#S%d) on %s\n", c.Kind, c.State, c.State, c.Lookahead)
+		result += "\n"
+		result += fmt.Sprintf("- %s\n", c.Items[0])
+		result += fmt.Sprintf("- %s\n", c.Items[1])
+		result += "\n"
+		if c.ByPrecedence {
+			result += fmt.Sprintf("Resolved by the precedence as %s.\n", c.Resolution)
+		} else {
+			result += fmt.Sprintf("Resolved as %s.\n", c.Resolution)
+		}
+		result += "\n"
+
+		example := c.Counterexample
+		switch {
+		case example == nil:
+			result += "No counterexample is found.\n"
+		case example.Unifying:
+			result += "Unifying counterexample, the grammar is ambiguous:\n"
+			result += "\n"
+			result += fmt.Sprintf("    %s\n", example.Examples[0])
+			result += "\n"
+			result += "Derivations:\n"
+			result += "\n"
+			result += fmt.Sprintf("    %s\n", example.Derivations[0])
+			result += fmt.Sprintf("    %s\n", example.Derivations[1])
+		default:
+			result += "Nonunifying counterexample:\n"
+			result += "\n"
+			for i := range example.Examples {
+				result += fmt.Sprintf("    %s\n", example.Examples[i])
+				result += fmt.Sprintf("    %s\n", example.Derivations[i])
+				result += "\n"
+			}
+		}
+		result += "\n"
+	}
+	return result
+}
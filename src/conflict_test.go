@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var conflictSymbols = map[string]string{
+	"NAME[IF]":   "if",
+	"NAME[THEN]": "then",
+	"NAME[ELSE]": "else",
+	"NAME":       "[a-z]+",
+	"NUMBER":     "[0-9]+",
+	"PLUS":       "\\+",
+}
+
+// expressions without precedence and the dangling else
+func createAmbiguousRules() []*SyntaxRule[any] {
+	return []*SyntaxRule[any]{
+		{
+			Name: "stmt",
+			Expand: []*RuleOps[any]{
+				{Ops: "IF expr THEN stmt"},
+				{Ops: "IF expr THEN stmt ELSE stmt"},
+				{Ops: "expr"},
+			},
+		},
+		{
+			Name: "expr",
+			Expand: []*RuleOps[any]{
+				{Ops: "expr PLUS expr"},
+				{Ops: "NUMBER"},
+				{Ops: "NAME"},
+			},
+		},
+	}
+}
+
+func TestCounterexample(t *testing.T) {
+	p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), []*Precedence{})
+	conflicts := p.Conflicts()
+	if len(conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %d", len(conflicts))
+	}
+
+	byLookahead := make(map[string]*Conflict)
+	for _, c := range conflicts {
+		t.Log(c)
+		if c.Kind != ShiftReduce || c.Resolution != "shift" || c.ByPrecedence {
+			t.Errorf("Unexpected conflict %s", c)
+		}
+		if c.Counterexample == nil || !c.Counterexample.Unifying {
+			t.Fatalf("Expected a unifying counterexample for %s", c)
+		}
+		t.Log(c.Counterexample.Derivations[0])
+		t.Log(c.Counterexample.Derivations[1])
+		byLookahead[c.Lookahead] = c
+	}
+
+	plus := byLookahead["PLUS"].Counterexample
+	if plus.Examples[0] != "expr PLUS expr . PLUS expr" {
+		t.Errorf("Unexpected example %s", plus.Examples[0])
+	}
+	dangling := byLookahead["ELSE"].Counterexample
+	if dangling.Examples[0] != "IF expr THEN IF expr THEN stmt . ELSE expr" {
+		t.Errorf("Unexpected example %s", dangling.Examples[0])
+	}
+	if dangling.Derivations[0] == dangling.Derivations[1] {
+		t.Errorf("Expected two derivations")
+	}
+
+	dir := t.TempDir()
+	p.WriteMDInfo("conflicts", dir)
+	md, err := os.ReadFile(filepath.Join(dir, "conflicts.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(md), "# Conflicts") ||
+		!strings.Contains(string(md), "IF expr THEN IF expr THEN stmt . ELSE expr") {
+		t.Errorf("Expected the counterexamples in the report")
+	}
+}
+
+func TestCounterexampleOtherAmbiguity(t *testing.T) {
+	symbols := map[string]string{"N": "n", "Y": "y", "Z": "z", "W": "w"}
+	// x and y need two lookaheads, and e is ambiguous whatever comes before
+	rules := []*SyntaxRule[any]{
+		{Name: "s", Expand: []*RuleOps[any]{{Ops: "x Y e Z"}, {Ops: "y Y W"}}},
+		{Name: "x", Expand: []*RuleOps[any]{{Ops: "N"}}},
+		{Name: "y", Expand: []*RuleOps[any]{{Ops: "N"}}},
+		{Name: "e", Expand: []*RuleOps[any]{{Ops: ""}, {Ops: "f"}}},
+		{Name: "f", Expand: []*RuleOps[any]{{Ops: ""}}},
+	}
+	p := CreateParser(symbols, []string{" "}, rules, []*Precedence{}, Expect{ReduceReduce: 2})
+	for _, c := range p.Conflicts() {
+		if c.Counterexample == nil {
+			t.Fatalf("Expected a counterexample for %s", c)
+		}
+		ce := c.Counterexample
+		switch c.Lookahead {
+		case "Y":
+			if ce.Unifying || ce.Examples != [2]string{"N . Y Z", "N . Y W"} {
+				t.Errorf("Expected a nonunifying counterexample for %s, got %v", c, ce)
+			}
+		case "Z":
+			if !ce.Unifying {
+				t.Errorf("Expected a unifying counterexample for %s, got %v", c, ce)
+			}
+		}
+	}
+}
+
+func TestConflictReduceItems(t *testing.T) {
+	symbols := map[string]string{"N": "n", "X": "x", "Z": "z"}
+	rules := []*SyntaxRule[any]{
+		{Name: "s", Expand: []*RuleOps[any]{{Ops: "N X"}, {Ops: "a X"}, {Ops: "b X Z"}}},
+		{Name: "a", Expand: []*RuleOps[any]{{Ops: "N"}}},
+		{Name: "b", Expand: []*RuleOps[any]{{Ops: "N"}}},
+	}
+	// the shift of X conflicts with the reductions of both a and b
+	p := CreateParser(symbols, []string{" "}, rules, []*Precedence{}, Expect{ShiftReduce: 2})
+	reduced := make([]string, 0)
+	for _, c := range p.Conflicts() {
+		reduced = append(reduced, c.Items[1])
+	}
+	if strings.Join(reduced, ", ") != "a -> N ., b -> N ." {
+		t.Errorf("Expected the conflicts of both reductions, got %v", reduced)
+	}
+}
+
+func TestConflictByPrecedence(t *testing.T) {
+	p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), []*Precedence{
+		{TokenType: []string{"PLUS"}, Level: 1},
+	})
+	for _, c := range p.Conflicts() {
+		// the precedence of the token and the rule tie, and shift is favored
+		if c.Lookahead == "PLUS" && (!c.ByPrecedence || c.Resolution != "shift") {
+			t.Errorf("Expected the conflict on PLUS resolved by the precedence, got %s", c)
+		}
+	}
+}
+
+func TestConflictPrecedenceOfRuleOnly(t *testing.T) {
+	// the rule of the dangling else has the precedence of THEN, but ELSE has
+	// none, so the conflict is not resolved by the precedence, as in yacc
+	precs := []*Precedence{
+		{TokenType: []string{"PLUS"}, Level: 1},
+		{TokenType: []string{"THEN"}, Level: 2},
+	}
+	p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), precs, Expect{ShiftReduce: 1})
+	for _, c := range p.Conflicts() {
+		if c.Lookahead == "ELSE" && (c.ByPrecedence || c.Resolution != "shift") {
+			t.Errorf("Expected the conflict on ELSE resolved by the default shift, got %s", c)
+		}
+	}
+	tree, err := p.ParseTree("if a then if b then 1 else 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the else goes with the nearest if
+	if len(tree.Children) != 4 {
+		t.Errorf("Unexpected tree %s", tree)
+	}
+}
+
+func TestConflictResolution(t *testing.T) {
+	// the dangling else, whose rule IF expr THEN stmt has the precedence of
+	// THEN. The else goes with the nearest if when ELSE is shifted, and is a
+	// syntax error when both ifs are reduced before it.
+	for _, c := range []struct {
+		name   string
+		precs  []*Precedence
+		reduce bool
+	}{
+		{"neither", nil, false},
+		{"token only", []*Precedence{{TokenType: []string{"ELSE"}, Level: 1}}, false},
+		// reduced before the precedence of the rule alone was ignored
+		{"rule only", []*Precedence{{TokenType: []string{"THEN"}, Level: 1}}, false},
+		{"token higher", []*Precedence{
+			{TokenType: []string{"THEN"}, Level: 1},
+			{TokenType: []string{"ELSE"}, Level: 2},
+		}, false},
+		{"rule higher", []*Precedence{
+			{TokenType: []string{"ELSE"}, Level: 1},
+			{TokenType: []string{"THEN"}, Level: 2},
+		}, true},
+	} {
+		p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), c.precs)
+		_, err := p.ParseTree("if a then if b then 1 else 2")
+		if reduced := err != nil; reduced != c.reduce {
+			t.Errorf("%s: expected the reduction %v, got the error %v", c.name, c.reduce, err)
+		}
+	}
+}
+
+func TestExpect(t *testing.T) {
+	precs := []*Precedence{{TokenType: []string{"PLUS"}, Level: 1}}
+	// the dangling else is the only conflict not resolved by the precedence
+	p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), precs, Expect{ShiftReduce: 1})
+	if _, err := p.ParseTree("if a then if b then 1 else 2 + 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "found 2 and 0") ||
+			!strings.Contains(fmt.Sprint(r), "expr -> expr PLUS expr .") {
+			t.Errorf("Expected panic for the unexpected conflict, got %v", r)
+		}
+	}()
+	CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), []*Precedence{}, Expect{ShiftReduce: 1})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Parser of any context-free grammar by the algorithm of Earley, for the
+// grammars which are left-recursive, ambiguous or not LR(1). It needs no LR
+// table, so it has no conflicts, and it gives the same trees and values as
+// the LR driver when the grammar is not ambiguous.
+type EarleyParser[T any] struct {
+	parser   *Parser[T]
+	nullable *StrSet
+}
+
+// An Earley item: the production, the number of its symbols before the dot
+// and the set where it was predicted
+type earleyItem struct {
+	prod   int
+	dot    int
+	origin int
+}
+
+// The items of a set of the chart, in the order they are found
+type earleySet struct {
+	items []earleyItem
+	has   map[earleyItem]bool
+}
+
+func (s *earleySet) add(item earleyItem) {
+	if !s.has[item] {
+		s.has[item] = true
+		s.items = append(s.items, item)
+	}
+}
+
+// Create an Earley parser of the rules. The precedence only declares the
+// tokens, since an ambiguous input gives all its parses.
+func CreateEarleyParser[T any](lrules map[string]string, ignore []string, srules []*SyntaxRule[T], precedence []*Precedence) *EarleyParser[T] {
+	lexer := CreateLexer(lrules, ignore)
+	grammar := defineGrammar(lexer, srules, precedence)
+	return &EarleyParser[T]{
+		parser:   newParser[T](lexer, grammar, nil),
+		nullable: grammar.nullableNonterminals(),
+	}
+}
+
+func (p *EarleyParser[T]) Tokenize(s string) ([]*Token, error) {
+	return p.parser.Tokenize(s)
+}
+
+// Parse s and run the actions of its parse, the first alternative of each
+// ambiguous node of the forest.
+func (p *EarleyParser[T]) Parse(s string) (T, error) {
+	forest, err := p.ParseForest(s)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return p.parser.EvalForest(forest, nil)
+}
+
+func (p *EarleyParser[T]) ParseToken(tokens []*Token) (T, error) {
+	forest, err := p.ParseTokenForest(tokens)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return p.parser.EvalForest(forest, nil)
+}
+
+// Parse s and return the syntax tree of its first parse
+func (p *EarleyParser[T]) ParseTree(s string) (*Node, error) {
+	forest, err := p.ParseForest(s)
+	if err != nil {
+		return nil, err
+	}
+	return forest.Tree(nil)
+}
+
+// Parse s and return the forest of all its parses, see Parser.ParseForest
+func (p *EarleyParser[T]) ParseForest(s string) (*Forest, error) {
+	tokens, tokenErr := p.Tokenize(s)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return p.ParseTokenForest(tokens)
+}
+
+// Run the actions of the parse of the forest picked by choose
+func (p *EarleyParser[T]) EvalForest(f *Forest, choose Chooser) (T, error) {
+	return p.parser.EvalForest(f, choose)
+}
+
+func (p *EarleyParser[T]) ParseTokenForest(tokens []*Token) (*Forest, error) {
+	g := p.parser.grammar
+	tokens = withEndToken(tokens)
+
+	// the start production S' -> start $end is complete after the end token
+	chart := make([]*earleySet, len(tokens)+1)
+	for i := range chart {
+		chart[i] = &earleySet{has: make(map[earleyItem]bool)}
+	}
+	chart[0].add(earleyItem{0, 0, 0})
+
+	for j := range tokens {
+		p.closeSet(chart, j)
+		for _, item := range chart[j].items {
+			prod := g.productions[item.prod]
+			if item.dot < prod.prodSize && prod.prod[item.dot] == tokens[j].Type {
+				chart[j+1].add(earleyItem{item.prod, item.dot + 1, item.origin})
+			}
+		}
+		if len(chart[j+1].items) == 0 {
+			return nil, fmt.Errorf("syntax error at line %d, token %s %s", tokens[j].Lineno, tokens[j].Type, tokens[j].Value)
+		}
+	}
+
+	end := len(tokens) - 1
+	b := &forestBuilder{
+		grammar:  g,
+		chart:    chart,
+		tokens:   tokens,
+		nodes:    make(map[forestKey]*ForestNode),
+		splitsOf: make(map[splitKey][][]int),
+	}
+	root := b.node(g.productions[0].prod[0], 0, end)
+	sortPacked(b.nodes)
+	return &Forest{
+		Root:        root,
+		Tokens:      tokens[:end],
+		productions: g.productions,
+	}, nil
+}
+
+// Predict and complete the items of the set j. A nullable symbol is also
+// skipped when it is predicted, as Aycock and Horspool do, so that the items
+// completed in the set they are predicted need no second pass.
+func (p *EarleyParser[T]) closeSet(chart []*earleySet, j int) {
+	g := p.parser.grammar
+	set := chart[j]
+	for i := 0; i < len(set.items); i++ {
+		item := set.items[i]
+		prod := g.productions[item.prod]
+
+		if item.dot == prod.prodSize {
+			// complete the items of the origin waiting for the symbol
+			origin := chart[item.origin]
+			for k := 0; k < len(origin.items); k++ {
+				waiting := origin.items[k]
+				wp := g.productions[waiting.prod]
+				if waiting.dot < wp.prodSize && wp.prod[waiting.dot] == prod.name {
+					set.add(earleyItem{waiting.prod, waiting.dot + 1, waiting.origin})
+				}
+			}
+			continue
+		}
+
+		next := prod.prod[item.dot]
+		for _, predicted := range g.prodNames[next] {
+			set.add(earleyItem{predicted.id, 0, j})
+		}
+		if p.nullable.contains(next) {
+			set.add(earleyItem{item.prod, item.dot + 1, item.origin})
+		}
+	}
+}
+
+// Build the forest from the complete items of the chart
+type forestBuilder struct {
+	grammar *grammar
+	chart   []*earleySet
+	tokens  []*Token
+	nodes   map[forestKey]*ForestNode
+	// the splits by production, number of symbols, start and end
+	splitsOf map[splitKey][][]int
+}
+
+type splitKey struct {
+	prod  int
+	k     int
+	start int
+	end   int
+}
+
+// The node of symbol derived from the tokens [start, end), with a packed node
+// for each way the productions of symbol derive them
+func (b *forestBuilder) node(symbol string, start int, end int) *ForestNode {
+	key := forestKey{symbol, start, end}
+	if node, ok := b.nodes[key]; ok {
+		return node
+	}
+
+	if _, ok := b.grammar.terminals[symbol]; ok {
+		node := &ForestNode{
+			Symbol: symbol,
+			Start:  start,
+			End:    end,
+			Span:   tokenSpan(b.tokens[start]),
+			Token:  b.tokens[start],
+		}
+		b.nodes[key] = node
+		return node
+	}
+
+	node := &ForestNode{
+		Symbol: symbol,
+		Start:  start,
+		End:    end,
+		Span:   joinSpans(nil, b.tokens[end]),
+		packed: make(map[string]bool),
+	}
+	if start < end {
+		node.Span = joinSpans([]Span{tokenSpan(b.tokens[start]), tokenSpan(b.tokens[end-1])}, b.tokens[end])
+	}
+	b.nodes[key] = node
+
+	for _, prod := range b.grammar.prodNames[symbol] {
+		if !b.chart[end].has[earleyItem{prod.id, prod.prodSize, start}] {
+			continue
+		}
+		for _, ends := range b.splits(prod, prod.prodSize, start, end) {
+			children := make([]*ForestNode, len(ends))
+			from := start
+			for i, to := range ends {
+				children[i] = b.node(prod.prod[i], from, to)
+				from = to
+			}
+			node.addPacked(prod.id, children)
+		}
+	}
+
+	// the span of the first alternative, as the LR driver joins the spans
+	// of the symbols
+	if len(node.Packed) > 0 {
+		spans := make([]Span, 0)
+		for _, child := range node.Packed[0].Children {
+			spans = append(spans, child.Span)
+		}
+		node.Span = joinSpans(spans, b.tokens[end])
+	}
+	return node
+}
+
+// The ends of the first k symbols of prod in each of their derivations of the
+// tokens [start, end). The chart has the item with the dot after the k-1
+// first symbols in the set where the k-th symbol begins. The splits are
+// shared by the nodes, like the nodes are by their parents.
+func (b *forestBuilder) splits(prod *production, k int, start int, end int) [][]int {
+	key := splitKey{prod.id, k, start, end}
+	if result, ok := b.splitsOf[key]; ok {
+		return result
+	}
+	result := b.split(prod, k, start, end)
+	b.splitsOf[key] = result
+	return result
+}
+
+// the splits of the first k symbols, from those of the first k-1 ones
+func (b *forestBuilder) split(prod *production, k int, start int, end int) [][]int {
+	if k == 0 {
+		if start == end {
+			return [][]int{{}}
+		}
+		return nil
+	}
+
+	result := make([][]int, 0)
+	symbol := prod.prod[k-1]
+	before := earleyItem{prod.id, k - 1, start}
+	if _, ok := b.grammar.terminals[symbol]; ok {
+		if end > start && b.tokens[end-1].Type == symbol && b.chart[end-1].has[before] {
+			for _, ends := range b.splits(prod, k-1, start, end-1) {
+				result = append(result, append(append([]int{}, ends...), end))
+			}
+		}
+		return result
+	}
+
+	for mid := start; mid <= end; mid++ {
+		if !b.chart[mid].has[before] || !b.derives(symbol, mid, end) {
+			continue
+		}
+		for _, ends := range b.splits(prod, k-1, start, mid) {
+			result = append(result, append(append([]int{}, ends...), end))
+		}
+	}
+	return result
+}
+
+// whether a production of symbol is complete from start to end
+func (b *forestBuilder) derives(symbol string, start int, end int) bool {
+	for _, prod := range b.grammar.prodNames[symbol] {
+		if b.chart[end].has[earleyItem{prod.id, prod.prodSize, start}] {
+			return true
+		}
+	}
+	return false
+}
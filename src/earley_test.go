@@ -0,0 +1,196 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var earleySymbols = map[string]string{
+	"NUMBER": "[0-9]+",
+	"PLUS":   "\\+",
+	"TIMES":  "\\*",
+	"LPAREN": "\\(",
+	"RPAREN": "\\)",
+}
+
+// expressions whose precedence is in the grammar
+func createTermRules() []*SyntaxRule[int] {
+	binary := func(op func(a, b int) int) func([]Value[int]) (int, error) {
+		return func(vals []Value[int]) (int, error) {
+			return op(vals[0].Val, vals[2].Val), nil
+		}
+	}
+	first := func(vals []Value[int]) (int, error) {
+		return vals[0].Val, nil
+	}
+	return []*SyntaxRule[int]{
+		{
+			Name: "expr",
+			Expand: []*RuleOps[int]{
+				{Ops: "expr PLUS term", RFunc: binary(func(a, b int) int { return a + b })},
+				{Ops: "term", RFunc: first},
+			},
+		},
+		{
+			Name: "term",
+			Expand: []*RuleOps[int]{
+				{Ops: "term TIMES factor", RFunc: binary(func(a, b int) int { return a * b })},
+				{Ops: "factor", RFunc: first},
+			},
+		},
+		{
+			Name: "factor",
+			Expand: []*RuleOps[int]{
+				{
+					Ops: "NUMBER",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return strconv.Atoi(vals[0].Token.Value)
+					},
+				},
+				{
+					Ops: "LPAREN expr RPAREN",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return vals[1].Val, nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestEarleyParser(t *testing.T) {
+	lr := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	earley := CreateEarleyParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+
+	for _, s := range []string{"1", "1 + 2 * 3", "(1 + 2) * 3 + 4 * (5 + 6)", "2 * 3 * 4 + 1 + 1"} {
+		expected, err := lr.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := earley.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, s, result)
+		}
+
+		expectedTree, _ := lr.ParseTree(s)
+		tree, err := earley.ParseTree(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.String() != expectedTree.String() || tree.Span != expectedTree.Span {
+			t.Errorf("Expected %s, got %s", expectedTree, tree)
+		}
+	}
+
+	if _, err := earley.Parse("1 + * 2"); err == nil || !strings.Contains(err.Error(), "token TIMES") {
+		t.Errorf("Expected a syntax error at TIMES, got %v", err)
+	}
+	if _, err := earley.Parse("(1 + 2"); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("Expected a syntax error at the end, got %v", err)
+	}
+}
+
+func TestEarleyAmbiguous(t *testing.T) {
+	glr := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), []*Precedence{})
+	earley := CreateEarleyParser(conflictSymbols, []string{" "}, createAmbiguousRules(), []*Precedence{})
+
+	for _, s := range []string{"1 + 2 + 3 + 4 + 5 + 6", "if a then if b then c else d + 1"} {
+		expected, err := glr.ParseForest(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forest, err := earley.ParseForest(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if forest.Count() != expected.Count() {
+			t.Fatalf("Expected %d parses of %s, got %d", expected.Count(), s, forest.Count())
+		}
+		// the same parses in the same order
+		expectedTrees := expected.Trees(0)
+		for i, tree := range forest.Trees(0) {
+			if tree.String() != expectedTrees[i].String() {
+				t.Errorf("Expected %s, got %s", expectedTrees[i], tree)
+			}
+		}
+	}
+}
+
+func TestEarleyNotLR(t *testing.T) {
+	symbols := map[string]string{
+		"A": "a",
+		"B": "b",
+	}
+	// the palindromes, whose middle can not be found with any lookahead
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "pal",
+			Expand: []*RuleOps[any]{
+				{Ops: "A pal A"},
+				{Ops: "B pal B"},
+				{Ops: "A"},
+				{Ops: "B"},
+			},
+		},
+	}
+	p := CreateEarleyParser(symbols, []string{" "}, rules, []*Precedence{})
+
+	tree, err := p.ParseTree("a b b a b b a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.String() != "(pal A:a (pal B:b (pal B:b (pal A:a) B:b) B:b) A:a)" {
+		t.Errorf("Unexpected tree %s", tree)
+	}
+	if _, err := p.ParseTree("a b b a"); err == nil {
+		t.Errorf("Expected a syntax error for an even palindrome")
+	}
+}
+
+func TestEarleyEmptyRules(t *testing.T) {
+	symbols := map[string]string{
+		"X": "x",
+		"B": "b",
+	}
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "a s B"},
+				{Ops: "a a X"},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any]{
+				{Ops: ""},
+			},
+		},
+	}
+	p := CreateEarleyParser(symbols, []string{" "}, rules, []*Precedence{})
+
+	forest, err := p.ParseForest("x b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := forest.Tree(nil)
+	if forest.Count() != 1 || tree.String() != "(s (a) (s (a) (a) X:x) B:b)" {
+		t.Errorf("Unexpected forest of %d parses: %s", forest.Count(), tree)
+	}
+}
+
+func TestEarleyMidAction(t *testing.T) {
+	p := CreateEarleyParser(pairSymbols, []string{" "}, createMidPairRules(), []*Precedence{})
+
+	result, err := p.Parse("(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "1:2" {
+		t.Errorf("Expected 1:2, got %s", result)
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Shared packed parse forest of the GLR driver. All the parses of the tokens
+// share the nodes of the symbols they derive from the same tokens.
+type Forest struct {
+	Root        *ForestNode
+	Tokens      []*Token
+	productions []*production
+}
+
+// A symbol derived from the tokens [Start, End). A terminal holds its Token,
+// a nonterminal holds a Packed node for each production deriving it there.
+type ForestNode struct {
+	Symbol string
+	Start  int
+	End    int
+	Span   Span
+	Token  *Token
+	Packed []*PackedNode
+	packed map[string]bool
+}
+
+// An alternative of a ForestNode: the production and the nodes of its symbols
+type PackedNode struct {
+	Production int
+	Children   []*ForestNode
+}
+
+// Chooser picks the alternative of an ambiguous node, as the index of one of
+// its Packed nodes. A nil Chooser picks the first one.
+type Chooser func(node *ForestNode) int
+
+// A node of the graph-structured stack: a state of the LR automaton reached
+// after the tokens before level, linked to the nodes it was pushed on.
+type gssNode struct {
+	state int
+	level int
+	edges []*gssEdge
+}
+
+type gssEdge struct {
+	to    *gssNode
+	label *ForestNode
+}
+
+type forestKey struct {
+	symbol string
+	start  int
+	end    int
+}
+
+// The actions of the GLR driver by state and terminal. They are the actions
+// of the LR table, plus the losing side of each conflict which is not resolved
+// by the precedence, so that the precedence still disambiguates.
+func (p *Parser[T]) glrActions() [][][]int32 {
+	p.glrOnce.Do(func() {
+		table := p.lrStates()
+		tables := table.tables
+		actions := make([][][]int32, len(table.closures))
+		for state := range actions {
+			actions[state] = make([][]int32, len(tables.terminals))
+			for term, action := range table.lrAction[state] {
+				var a int32
+				switch action[0] {
+				case 's':
+					a = shiftAction(turnAction2id(action))
+				case 'r':
+					a = reduceAction(turnAction2id(action))
+				default:
+					a = acceptAction
+				}
+				actions[state][tables.terminals[term]] = []int32{a}
+			}
+		}
+		for _, c := range table.unresolvedConflicts() {
+			loser := c.items[0]
+			if loser == c.winner {
+				loser = c.items[1]
+			}
+			a := reduceAction(loser.number)
+			if (loser.lrIndex + 1) != loser.len {
+				a = shiftAction(table.transitions[c.state][c.lookahead])
+			}
+			column := &actions[c.state][tables.terminals[c.lookahead]]
+			*column = append(*column, a)
+		}
+		p.glr = actions
+	})
+
+	return p.glr
+}
+
+// Parse s with the GLR driver, which follows all the actions of the
+// conflicts, and return the forest of all the parses of s.
+func (p *Parser[T]) ParseForest(s string) (*Forest, error) {
+	tokens, tokenErr := p.Tokenize(s)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return p.ParseTokenForest(tokens)
+}
+
+func (p *Parser[T]) ParseTokenForest(tokens []*Token) (*Forest, error) {
+	actions := p.glrActions()
+	tokens = withEndToken(tokens)
+
+	g := &glrParse[T]{
+		p:       p,
+		actions: actions,
+		tokens:  tokens,
+		terms:   p.table.tables.tokenTerminals(tokens),
+		nodes:   make(map[forestKey]*ForestNode),
+	}
+	return g.parse()
+}
+
+// The state of a GLR parse: the nodes of the stack at the current level, by
+// state and in the order they are found
+type glrParse[T any] struct {
+	p       *Parser[T]
+	actions [][][]int32
+	tokens  []*Token
+	terms   []int
+	nodes   map[forestKey]*ForestNode
+
+	level     int
+	frontier  []*gssNode
+	byState   map[int]*gssNode
+	processed int // the nodes of the frontier whose reductions are done
+}
+
+func (g *glrParse[T]) actionsOf(state int) []int32 {
+	term := g.terms[g.level]
+	if term < 0 {
+		return nil
+	}
+	return g.actions[state][term]
+}
+
+func (g *glrParse[T]) parse() (*Forest, error) {
+	start := &gssNode{state: 0}
+	g.frontier = []*gssNode{start}
+	g.byState = map[int]*gssNode{0: start}
+
+	end := len(g.tokens) - 1
+	for {
+		g.reduceAll()
+
+		if g.level == end {
+			if !g.accepted() {
+				break
+			}
+			root := g.nodes[forestKey{g.p.grammar.productions[0].prod[0], 0, end}]
+			sortPacked(g.nodes)
+			return &Forest{
+				Root:        root,
+				Tokens:      g.tokens[:end],
+				productions: g.p.grammar.productions,
+			}, nil
+		}
+		if !g.shiftAll() {
+			break
+		}
+	}
+
+	token := g.tokens[g.level]
+	return nil, fmt.Errorf("syntax error at line %d, token %s %s", token.Lineno, token.Type, token.Value)
+}
+
+// Apply the reductions of the nodes of the level, including those of the
+// nodes they push.
+func (g *glrParse[T]) reduceAll() {
+	g.processed = 0
+	for g.processed < len(g.frontier) {
+		v := g.frontier[g.processed]
+		g.processed++
+		for _, a := range g.actionsOf(v.state) {
+			if a < acceptAction {
+				g.reducePaths(v, int(-a-1), nil)
+			}
+		}
+	}
+}
+
+// Reduce the production prod on the paths from v, or on those through the
+// edge via if it is not nil.
+func (g *glrParse[T]) reducePaths(v *gssNode, prod int, via *gssEdge) {
+	size := g.p.grammar.productions[prod].prodSize
+	type path struct {
+		to     *gssNode
+		labels []*ForestNode
+	}
+	paths := make([]path, 0)
+	labels := make([]*ForestNode, size)
+
+	var walk func(node *gssNode, depth int, through bool)
+	walk = func(node *gssNode, depth int, through bool) {
+		if depth == 0 {
+			if via == nil || through {
+				paths = append(paths, path{node, append([]*ForestNode{}, labels...)})
+			}
+			return
+		}
+		for _, e := range node.edges {
+			labels[depth-1] = e.label
+			walk(e.to, depth-1, through || e == via)
+		}
+	}
+	walk(v, size, false)
+
+	for _, path := range paths {
+		g.reduce(prod, path.to, path.labels)
+	}
+}
+
+// Reduce prod, whose symbols are derived by labels, from the node u
+func (g *glrParse[T]) reduce(prod int, u *gssNode, labels []*ForestNode) {
+	production := g.p.grammar.productions[prod]
+	node := g.forestNode(production.name, u.level, labels)
+	node.addPacked(prod, labels)
+
+	next := g.p.table.tables.gotoOf(u.state, prod)
+	if next < 0 {
+		return
+	}
+	w, ok := g.byState[next]
+	if !ok {
+		w = &gssNode{state: next, level: g.level}
+		g.byState[next] = w
+		g.frontier = append(g.frontier, w)
+	}
+	for _, e := range w.edges {
+		// the symbol of the edge is the one before the dot of the state w,
+		// so its label is node
+		if e.to == u {
+			return
+		}
+	}
+	e := &gssEdge{to: u, label: node}
+	w.edges = append(w.edges, e)
+
+	if !ok {
+		return
+	}
+	// the nodes whose reductions are done may reduce through the new edge
+	for _, x := range g.frontier[:g.processed] {
+		for _, a := range g.actionsOf(x.state) {
+			if a < acceptAction && g.p.grammar.productions[-a-1].prodSize > 0 {
+				g.reducePaths(x, int(-a-1), e)
+			}
+		}
+	}
+}
+
+// Shift the token of the level, return false if no node can shift it
+func (g *glrParse[T]) shiftAll() bool {
+	token := g.tokens[g.level]
+	leaf := &ForestNode{
+		Symbol: token.Type,
+		Start:  g.level,
+		End:    g.level + 1,
+		Span:   tokenSpan(token),
+		Token:  token,
+	}
+
+	frontier := make([]*gssNode, 0)
+	byState := make(map[int]*gssNode)
+	for _, v := range g.frontier {
+		for _, a := range g.actionsOf(v.state) {
+			if a <= 0 {
+				continue
+			}
+			next := int(a - 1)
+			w, ok := byState[next]
+			if !ok {
+				w = &gssNode{state: next, level: g.level + 1}
+				byState[next] = w
+				frontier = append(frontier, w)
+			}
+			w.edges = append(w.edges, &gssEdge{to: v, label: leaf})
+		}
+	}
+
+	g.level++
+	g.frontier = frontier
+	g.byState = byState
+	return len(frontier) > 0
+}
+
+// The end token is shifted by a node of the start symbol into the state which
+// accepts.
+func (g *glrParse[T]) accepted() bool {
+	for _, v := range g.frontier {
+		for _, a := range g.actionsOf(v.state) {
+			if a <= 0 {
+				continue
+			}
+			for _, b := range g.actions[a-1][g.terms[g.level]] {
+				if b == acceptAction {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// The node of symbol derived from the tokens after start to the level, which
+// is located by the labels of its first alternative.
+func (g *glrParse[T]) forestNode(symbol string, start int, labels []*ForestNode) *ForestNode {
+	key := forestKey{symbol, start, g.level}
+	if node, ok := g.nodes[key]; ok {
+		return node
+	}
+	spans := make([]Span, len(labels))
+	for i, label := range labels {
+		spans[i] = label.Span
+	}
+	node := &ForestNode{
+		Symbol: symbol,
+		Start:  start,
+		End:    g.level,
+		Span:   joinSpans(spans, g.tokens[g.level]),
+		packed: make(map[string]bool),
+	}
+	g.nodes[key] = node
+	return node
+}
+
+func (n *ForestNode) addPacked(prod int, children []*ForestNode) {
+	key := fmt.Sprint(prod)
+	for _, child := range children {
+		key += fmt.Sprintf("|%d", child.End)
+	}
+	if n.packed[key] {
+		return
+	}
+	n.packed[key] = true
+	n.Packed = append(n.Packed, &PackedNode{Production: prod, Children: children})
+}
+
+// Order the alternatives by production and then by the ends of their
+// symbols, so that the forest does not depend on the order of the reductions.
+func sortPacked(nodes map[forestKey]*ForestNode) {
+	for _, node := range nodes {
+		sort.Slice(node.Packed, func(i, j int) bool {
+			a, b := node.Packed[i], node.Packed[j]
+			if a.Production != b.Production {
+				return a.Production < b.Production
+			}
+			for k := range a.Children {
+				if a.Children[k].End != b.Children[k].End {
+					return a.Children[k].End < b.Children[k].End
+				}
+			}
+			return false
+		})
+	}
+}
+
+func (n *ForestNode) IsAmbiguous() bool {
+	return len(n.Packed) > 1
+}
+
+// Whether a node of the forest has more than one alternative
+func (f *Forest) IsAmbiguous() bool {
+	ambiguous := false
+	f.walk(func(n *ForestNode) {
+		if n.IsAmbiguous() {
+			ambiguous = true
+		}
+	})
+	return ambiguous
+}
+
+// visit each node reachable from the root once
+func (f *Forest) walk(visit func(n *ForestNode)) {
+	seen := make(map[*ForestNode]bool)
+	var walk func(n *ForestNode)
+	walk = func(n *ForestNode) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		visit(n)
+		for _, packed := range n.Packed {
+			for _, child := range packed.Children {
+				walk(child)
+			}
+		}
+	}
+	walk(f.Root)
+}
+
+// Number of the parses in the forest, math.MaxInt if there are more. The
+// derivations through a cycle of the grammar are left out.
+func (f *Forest) Count() int {
+	counts := make(map[*ForestNode]int)
+	onPath := make(map[*ForestNode]bool)
+	var count func(n *ForestNode) int
+	count = func(n *ForestNode) int {
+		if n.Token != nil {
+			return 1
+		}
+		if c, ok := counts[n]; ok {
+			return c
+		}
+		if onPath[n] {
+			return 0
+		}
+		onPath[n] = true
+		total := 0
+		for _, packed := range n.Packed {
+			product := 1
+			for _, child := range packed.Children {
+				c := count(child)
+				if c != 0 && product > math.MaxInt/c {
+					product = math.MaxInt
+				} else {
+					product *= c
+				}
+			}
+			if total > math.MaxInt-product {
+				total = math.MaxInt
+			} else {
+				total += product
+			}
+		}
+		onPath[n] = false
+		counts[n] = total
+		return total
+	}
+	return count(f.Root)
+}
+
+// The syntax trees of the parses, at most limit of them if limit > 0. The
+// trees share their common subtrees.
+func (f *Forest) Trees(limit int) []*Node {
+	trees := make(map[*ForestNode][]*Node)
+	onPath := make(map[*ForestNode]bool)
+
+	var enumerate func(n *ForestNode) []*Node
+	enumerate = func(n *ForestNode) []*Node {
+		if n.Token != nil {
+			return []*Node{tokenNode(n)}
+		}
+		if result, ok := trees[n]; ok {
+			return result
+		}
+		if onPath[n] {
+			return nil
+		}
+		onPath[n] = true
+		result := make([]*Node, 0)
+		for _, packed := range n.Packed {
+			// the trees of the symbols, combined one by one
+			combos := [][]*Node{{}}
+			for _, child := range packed.Children {
+				next := make([][]*Node, 0)
+				for _, combo := range combos {
+					for _, tree := range enumerate(child) {
+						next = append(next, append(append([]*Node{}, combo...), tree))
+					}
+				}
+				combos = truncate(next, limit)
+			}
+			for _, combo := range combos {
+				result = append(result, f.packedNode(n, packed, combo))
+			}
+		}
+		onPath[n] = false
+		result = truncate(result, limit)
+		trees[n] = result
+		return result
+	}
+	return enumerate(f.Root)
+}
+
+func truncate[E any](s []E, limit int) []E {
+	if limit > 0 && len(s) > limit {
+		return s[:limit]
+	}
+	return s
+}
+
+// The syntax tree of the parse picked by choose
+func (f *Forest) Tree(choose Chooser) (*Node, error) {
+	onPath := make(map[*ForestNode]bool)
+	var build func(n *ForestNode) (*Node, error)
+	build = func(n *ForestNode) (*Node, error) {
+		if n.Token != nil {
+			return tokenNode(n), nil
+		}
+		packed, err := pick(n, choose, onPath)
+		if err != nil {
+			return nil, err
+		}
+		onPath[n] = true
+		defer delete(onPath, n)
+
+		children := make([]*Node, len(packed.Children))
+		for i, child := range packed.Children {
+			if children[i], err = build(child); err != nil {
+				return nil, err
+			}
+		}
+		return f.packedNode(n, packed, children), nil
+	}
+	return build(f.Root)
+}
+
+// the alternative of n picked by choose
+func pick(n *ForestNode, choose Chooser, onPath map[*ForestNode]bool) (*PackedNode, error) {
+	if onPath[n] {
+		return nil, fmt.Errorf("cyclic derivation of %s", n.Symbol)
+	}
+	i := 0
+	if choose != nil && len(n.Packed) > 1 {
+		i = choose(n)
+	}
+	if i < 0 || i >= len(n.Packed) {
+		return nil, fmt.Errorf("no alternative %d of %s", i, n.Symbol)
+	}
+	return n.Packed[i], nil
+}
+
+func tokenNode(n *ForestNode) *Node {
+	return valueNode(n.Symbol, Value[any]{Token: n.Token}, n.Span)
+}
+
+// the tree of the alternative packed of n, with the trees of its symbols
+func (f *Forest) packedNode(n *ForestNode, packed *PackedNode, children []*Node) *Node {
+	vals := make([]Value[any], len(children))
+	spans := make([]Span, len(children))
+	for i, child := range children {
+		vals[i] = Value[any]{Node: child}
+		spans[i] = packed.Children[i].Span
+	}
+	return createNode(f.productions[packed.Production], vals, spans, n.Span)
+}
+
+// Run the actions of the parse picked by choose, as the LR driver does. The
+// mid-rule actions run when their rule is evaluated, so the actions of the
+// parses left out never run.
+func (p *Parser[T]) EvalForest(f *Forest, choose Chooser) (T, error) {
+	onPath := make(map[*ForestNode]bool)
+	var eval func(n *ForestNode, before []Value[T]) (Value[T], error)
+	eval = func(n *ForestNode, before []Value[T]) (Value[T], error) {
+		if n.Token != nil {
+			return Value[T]{Token: n.Token}, nil
+		}
+		packed, err := pick(n, choose, onPath)
+		if err != nil {
+			return Value[T]{}, err
+		}
+		onPath[n] = true
+		defer delete(onPath, n)
+
+		vals := make([]Value[T], 0, len(packed.Children))
+		spans := make([]Span, 0, len(packed.Children))
+		for _, child := range packed.Children {
+			val, err := eval(child, vals)
+			if err != nil {
+				return Value[T]{}, err
+			}
+			vals = append(vals, val)
+			spans = append(spans, child.Span)
+		}
+
+		prod := p.grammar.productions[packed.Production]
+		action := p.actions[packed.Production]
+		if action == nil {
+			return Value[T]{Node: createNode(prod, vals, spans, n.Span)}, nil
+		}
+		// a mid-rule action gets the values before it in its rule
+		if prod.midDepth > 0 {
+			vals = before[len(before)-prod.midDepth:]
+		}
+		returned, err := action(vals)
+		if err != nil {
+			return Value[T]{}, fmt.Errorf("Semantics Error: %s, line %d", err.Error(), n.Span.EndLine)
+		}
+		return returned, nil
+	}
+
+	result, err := eval(f.Root, nil)
+	return result.Val, err
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseForest(t *testing.T) {
+	p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), []*Precedence{})
+
+	forest, err := p.ParseForest("1 + 2 + 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forest.Count() != 2 || !forest.IsAmbiguous() {
+		t.Fatalf("Expected 2 parses, got %d", forest.Count())
+	}
+	trees := forest.Trees(0)
+	expected := []string{
+		"(stmt (expr (expr NUMBER:1) PLUS:+ (expr (expr NUMBER:2) PLUS:+ (expr NUMBER:3))))",
+		"(stmt (expr (expr (expr NUMBER:1) PLUS:+ (expr NUMBER:2)) PLUS:+ (expr NUMBER:3)))",
+	}
+	for i, tree := range trees {
+		if tree.String() != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], tree)
+		}
+	}
+	if trees := forest.Trees(1); len(trees) != 1 {
+		t.Errorf("Expected 1 tree, got %d", len(trees))
+	}
+
+	forest, err = p.ParseForest("if a then if b then c else d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forest.Count() != 2 {
+		t.Errorf("Expected 2 parses of the dangling else, got %d", forest.Count())
+	}
+
+	// the more operands, the more parses: the Catalan numbers
+	forest, err = p.ParseForest("1 + 2 + 3 + 4 + 5 + 6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forest.Count() != 42 {
+		t.Errorf("Expected 42 parses, got %d", forest.Count())
+	}
+
+	if _, err := p.ParseForest("1 + + 2"); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("Expected a syntax error, got %v", err)
+	}
+}
+
+func TestForestUnambiguous(t *testing.T) {
+	calc := createCalc()
+	p := calc.parser
+
+	for _, s := range []string{"1 + 2 * 3", "-(4 - 1) / 3", "a = 2 * 3 - 1"} {
+		forest, err := p.ParseForest(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the precedence still resolves the conflicts
+		if forest.Count() != 1 || forest.IsAmbiguous() {
+			t.Errorf("Expected 1 parse of %s, got %d", s, forest.Count())
+		}
+
+		tree, err := forest.Tree(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := p.ParseTree(s)
+		if tree.String() != expected.String() || tree.Span != expected.Span {
+			t.Errorf("Expected %s, got %s", expected, tree)
+		}
+
+		val, err := p.EvalForest(forest, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, _ := p.Parse(s); val != result {
+			t.Errorf("Expected %d for %s, got %d", result, s, val)
+		}
+	}
+}
+
+func TestEvalForest(t *testing.T) {
+	symbols := map[string]string{
+		"NUMBER": "[0-9]+",
+		"MINUS":  "-",
+	}
+	rules := []*SyntaxRule[int]{
+		{
+			Name: "expr",
+			Expand: []*RuleOps[int]{
+				{
+					Ops: "expr MINUS expr",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return vals[0].Val - vals[2].Val, nil
+					},
+				},
+				{
+					Ops: "NUMBER",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return strconv.Atoi(vals[0].Token.Value)
+					},
+				},
+			},
+		},
+	}
+	p := CreateParser(symbols, []string{" "}, rules, []*Precedence{})
+
+	forest, err := p.ParseForest("8 - 4 - 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the alternatives are ordered by the end of their first symbol
+	right, err := p.EvalForest(forest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, err := p.EvalForest(forest, func(n *ForestNode) int {
+		return len(n.Packed) - 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if right != 6 || left != 2 {
+		t.Errorf("Expected 6 and 2, got %d and %d", right, left)
+	}
+
+	if _, err := p.EvalForest(forest, func(n *ForestNode) int { return 2 }); err == nil {
+		t.Errorf("Expected an error for a wrong alternative")
+	}
+}
+
+func TestForestEmptyRules(t *testing.T) {
+	symbols := map[string]string{
+		"X": "x",
+		"B": "b",
+	}
+	// the hidden left recursion of s is a shift/reduce conflict on X
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "a s B"},
+				{Ops: "X"},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any]{
+				{Ops: ""},
+			},
+		},
+	}
+	p := CreateParser(symbols, []string{" "}, rules, []*Precedence{})
+	if _, err := p.Parse("x b b"); err == nil {
+		t.Errorf("Expected the LR driver to fail")
+	}
+
+	forest, err := p.ParseForest("x b b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := forest.Tree(nil)
+	if forest.Count() != 1 || tree.String() != "(s (a) (s (a) (s X:x) B:b) B:b)" {
+		t.Errorf("Unexpected forest of %d parses: %s", forest.Count(), tree)
+	}
+}
+
+// the pair whose mid-rule action gets the first number
+func createMidPairRules() []*SyntaxRule[string] {
+	return []*SyntaxRule[string]{
+		{
+			Name: "pair",
+			Expand: []*RuleOps[string]{
+				{
+					Ops:  "LPAREN first=NUMBER {open} COMMA second=NUMBER RPAREN",
+					Refs: []string{"open", "second"},
+					Action: func(ctx *ActionCtx[string]) (string, error) {
+						return ctx.Val("open") + ctx.Token("second").Value, nil
+					},
+					Mid: []*MidAction[string]{
+						{
+							Name: "open",
+							Refs: []string{"first"},
+							Action: func(ctx *ActionCtx[string]) (string, error) {
+								return ctx.Token("first").Value + ":", nil
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestForestMidAction(t *testing.T) {
+	p := CreateParser(pairSymbols, []string{" "}, createMidPairRules(), []*Precedence{})
+
+	forest, err := p.ParseForest("(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.EvalForest(forest, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "1:2" {
+		t.Errorf("Expected 1:2, got %s", result)
+	}
+}
+
+func TestForestLoadedParser(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, LR1)
+	tables, err := p.MarshalTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadParser(tables, lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the LR states are built for the GLR driver
+	forest, err := loaded.ParseForest("a x c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := p.ParseForest("a x c")
+	tree, _ := forest.Tree(nil)
+	expectedTree, _ := expected.Tree(nil)
+	if forest.Count() != 1 || tree.String() != expectedTree.String() {
+		t.Errorf("Expected the tree %s, got %s", expectedTree, tree)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"slices"
+)
+
+// The canonical key of an item: its production and the position of its dot
+func itemKey(item *LRItem) uint64 {
+	return uint64(item.number)<<32 | uint64(uint32(item.lrIndex))
+}
+
+// Interning of the LR(0) item sets. Two item sets are the same state if they
+// have exactly the same items, whatever their order, so a set is keyed by the
+// sorted keys of its items. The hash only picks the bucket, and the sets of a
+// bucket are compared item by item, so distinct sets are never merged.
+type itemSets struct {
+	buckets map[uint64][]int // hash: ids of the sets
+	keys    [][]uint64       // id: sorted keys of the set
+}
+
+func createItemSets() *itemSets {
+	return &itemSets{
+		buckets: make(map[uint64][]int),
+		keys:    make([][]uint64, 0),
+	}
+}
+
+func sortedItemKeys(items []*LRItem) []uint64 {
+	keys := make([]uint64, len(items))
+	for i, item := range items {
+		keys[i] = itemKey(item)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// FNV-1a over the keys
+func hashItemKeys(keys []uint64) uint64 {
+	hash := uint64(14695981039346656037)
+	for _, key := range keys {
+		for i := 0; i < 64; i += 8 {
+			hash ^= (key >> i) & 0xff
+			hash *= 1099511628211
+		}
+	}
+	return hash
+}
+
+// Get the id of the item set, adding it with the next id if it is new
+func (s *itemSets) intern(items []*LRItem) (int, bool) {
+	keys := sortedItemKeys(items)
+	hash := hashItemKeys(keys)
+	for _, id := range s.buckets[hash] {
+		if slices.Equal(s.keys[id], keys) {
+			return id, false
+		}
+	}
+
+	id := len(s.keys)
+	s.keys = append(s.keys, keys)
+	s.buckets[hash] = append(s.buckets[hash], id)
+	return id, true
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type LLConflictKind int
+
+const (
+	FirstFirst LLConflictKind = iota
+	FirstFollow
+)
+
+func (k LLConflictKind) String() string {
+	if k == FirstFirst {
+		return "FIRST/FIRST"
+	}
+	return "FIRST/FOLLOW"
+}
+
+// A conflict of the LL(1) table: two productions of Nonterminal are predicted
+// on Lookahead, both by their FIRST sets, or one of them by the FOLLOW set of
+// Nonterminal since it derives the empty string. The production defined first
+// is predicted.
+type LLConflict struct {
+	Kind        LLConflictKind
+	Nonterminal string
+	Lookahead   string
+	Productions [2]string
+}
+
+func (c *LLConflict) String() string {
+	return fmt.Sprintf("%s conflict of %s on %s between %s and %s",
+		c.Kind, c.Nonterminal, c.Lookahead, c.Productions[0], c.Productions[1])
+}
+
+// The predictive table of the grammar, built from its FIRST and FOLLOW sets
+type llTable struct {
+	grammar *grammar
+	// nonterminal: terminal: the productions predicted, the first one wins
+	predict   map[string]map[string][]int
+	conflicts []*LLConflict
+}
+
+// Predict A -> w on the terminals of FIRST(w), and on FOLLOW(A) if w derives
+// the empty string.
+func buildLLTable(g *grammar) *llTable {
+	table := &llTable{
+		grammar:   g,
+		predict:   make(map[string]map[string][]int),
+		conflicts: make([]*LLConflict, 0),
+	}
+	// whether the production was predicted on the terminal by FOLLOW
+	byFollow := make(map[string]bool)
+
+	for _, prod := range g.productions {
+		row, ok := table.predict[prod.name]
+		if !ok {
+			row = make(map[string][]int)
+			table.predict[prod.name] = row
+		}
+		add := func(term string, follow bool) {
+			for _, other := range row[term] {
+				kind := FirstFirst
+				if follow || byFollow[fmt.Sprintf("%d-%s", other, term)] {
+					kind = FirstFollow
+				}
+				table.conflicts = append(table.conflicts, &LLConflict{
+					Kind:        kind,
+					Nonterminal: prod.name,
+					Lookahead:   term,
+					Productions: [2]string{productionString(g.productions[other]), productionString(prod)},
+				})
+			}
+			row[term] = append(row[term], prod.id)
+			byFollow[fmt.Sprintf("%d-%s", prod.id, term)] = follow
+		}
+
+		first := g.getFirstFromProd(&prod.prod)
+		for _, term := range first.sorted() {
+			if term != EMPTYTOKEN {
+				add(term, false)
+			}
+		}
+		if first.contains(EMPTYTOKEN) && g.follow[prod.name] != nil {
+			for _, term := range g.follow[prod.name].sorted() {
+				if !first.contains(term) {
+					add(term, true)
+				}
+			}
+		}
+	}
+	return table
+}
+
+func (self *llTable) countConflicts() (int, int) {
+	ff, fo := 0, 0
+	for _, c := range self.conflicts {
+		if c.Kind == FirstFirst {
+			ff++
+		} else {
+			fo++
+		}
+	}
+	return ff, fo
+}
+
+// Parser of the LL(1) grammars by a predictive table. A grammar which is not
+// LL(1), e.g. a left-recursive one, is parsed with the production defined
+// first in each conflict.
+type LLParser[T any] struct {
+	parser *Parser[T]
+	table  *llTable
+}
+
+func CreateLLParser[T any](lrules map[string]string, ignore []string, srules []*SyntaxRule[T], precedence []*Precedence) *LLParser[T] {
+	lexer := CreateLexer(lrules, ignore)
+	grammar := CreateGrammar(lexer, srules, precedence)
+	table := buildLLTable(grammar)
+	if ff, fo := table.countConflicts(); ff > 0 || fo > 0 {
+		fmt.Printf("%d FIRST/FIRST and %d FIRST/FOLLOW conflict(s) !! \n", ff, fo)
+	}
+
+	return &LLParser[T]{
+		parser: newParser[T](lexer, grammar, nil),
+		table:  table,
+	}
+}
+
+// The conflicts of the LL(1) table, in the order of the productions
+func (p *LLParser[T]) Conflicts() []*LLConflict {
+	return p.table.conflicts
+}
+
+func (p *LLParser[T]) Tokenize(s string) ([]*Token, error) {
+	return p.parser.Tokenize(s)
+}
+
+func (p *LLParser[T]) Parse(s string) (T, error) {
+	tokens, tokenErr := p.Tokenize(s)
+	if tokenErr != nil {
+		var zero T
+		return zero, tokenErr
+	}
+	return p.ParseToken(tokens)
+}
+
+func (p *LLParser[T]) ParseToken(tokens []*Token) (T, error) {
+	forest, err := p.parseToken(tokens)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return p.parser.EvalForest(forest, nil)
+}
+
+func (p *LLParser[T]) ParseTree(s string) (*Node, error) {
+	tokens, tokenErr := p.Tokenize(s)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return p.ParseTokenTree(tokens)
+}
+
+func (p *LLParser[T]) ParseTokenTree(tokens []*Token) (*Node, error) {
+	forest, err := p.parseToken(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return forest.Tree(nil)
+}
+
+// A production being expanded by the predictive driver
+type llFrame struct {
+	node   *ForestNode
+	packed *PackedNode
+	prod   *production
+}
+
+// Run the predictive driver over tokens. The derivation is returned as a
+// forest of one parse, so that its tree and its actions are those of the other
+// drivers.
+func (p *LLParser[T]) parseToken(tokens []*Token) (*Forest, error) {
+	g := p.parser.grammar
+	tokens = withEndToken(tokens)
+	current := 0
+	syntaxError := func() error {
+		token := tokens[current]
+		return fmt.Errorf("syntax error at line %d, token %s %s", token.Lineno, token.Type, token.Value)
+	}
+
+	// expand a node of the nonterminal at the current token
+	stack := make([]*llFrame, 0)
+	expand := func(prod *production) {
+		node := &ForestNode{Symbol: prod.name, Start: current}
+		packed := &PackedNode{Production: prod.id, Children: make([]*ForestNode, 0, prod.prodSize)}
+		node.Packed = []*PackedNode{packed}
+		stack = append(stack, &llFrame{node, packed, prod})
+	}
+	expand(g.productions[0])
+
+	for {
+		top := stack[len(stack)-1]
+		next := len(top.packed.Children)
+
+		if next == top.prod.prodSize {
+			// the production is done, its span is the one of its symbols
+			stack = stack[:len(stack)-1]
+			spans := make([]Span, 0, len(top.packed.Children))
+			for _, child := range top.packed.Children {
+				spans = append(spans, child.Span)
+			}
+			top.node.End = current
+			top.node.Span = joinSpans(spans, tokens[min(current, len(tokens)-1)])
+			if len(stack) == 0 {
+				// S' -> start $end
+				return &Forest{
+					Root:        top.packed.Children[0],
+					Tokens:      tokens[:len(tokens)-1],
+					productions: g.productions,
+				}, nil
+			}
+			parent := stack[len(stack)-1].packed
+			parent.Children = append(parent.Children, top.node)
+			continue
+		}
+
+		symbol := top.prod.prod[next]
+		token := tokens[current]
+		if _, ok := g.terminals[symbol]; ok || symbol == ENDTOKEN {
+			if token.Type != symbol {
+				return nil, syntaxError()
+			}
+			top.packed.Children = append(top.packed.Children, &ForestNode{
+				Symbol: symbol,
+				Start:  current,
+				End:    current + 1,
+				Span:   tokenSpan(token),
+				Token:  token,
+			})
+			current++
+			continue
+		}
+
+		predicted := p.table.predict[symbol][token.Type]
+		if len(predicted) == 0 {
+			return nil, syntaxError()
+		}
+		// a left recursion expands the nonterminal again without reading
+		for _, frame := range stack {
+			if frame.node.Symbol == symbol && frame.node.Start == current {
+				return nil, fmt.Errorf("left recursion of %s at line %d, token %s %s", symbol, token.Lineno, token.Type, token.Value)
+			}
+		}
+		expand(g.productions[predicted[0]])
+	}
+}
+
+// Write the lexer, the grammar and the LL(1) table of the parser
+func (p *LLParser[T]) WriteMDInfo(name string, path string) {
+	result := p.parser.lexMD()
+	result += p.parser.grammarMD()
+	result += p.parser.llMD(p.table)
+	writeMD(name, path, result)
+}
+
+// The LL(1) table of the grammar and its conflicts
+func (p *Parser[T]) llMD(table *llTable) string {
+	g := p.grammar
+	terms := []string{ENDTOKEN}
+	for term := range g.terminals {
+		if term != ENDTOKEN {
+			terms = append(terms, term)
+		}
+	}
+	sort.Strings(terms[1:])
+
+	result := "# LL(1) Table\n"
+	result += "\n"
+	result += "| Nonterminal |"
+	for _, term := range terms {
+		result += fmt.Sprintf(" %s |", term)
+	}
+	result += "\n| --- |"
+	for range terms {
+		result += " --- |"
+	}
+	result += "\n"
+
+	done := createSet()
+	for _, prod := range g.productions {
+		if done.contains(prod.name) {
+			continue
+		}
+		done.add(prod.name)
+		result += fmt.Sprintf("| %s |", prod.name)
+		for _, term := range terms {
+			cell := ""
+			for i, id := range table.predict[prod.name][term] {
+				if i > 0 {
+					cell += ", "
+				}
+				cell += fmt.Sprintf("[P%d](#P%d)", id, id)
+			}
+			result += fmt.Sprintf(" %s |", cell)
+		}
+		result += "\n"
+	}
+	result += "\n"
+
+	result += "## LL(1) Conflicts\n"
+	result += "\n"
+	if len(table.conflicts) == 0 {
+		result += "The grammar is LL(1).\n"
+	}
+	for _, c := range table.conflicts {
+		result += fmt.Sprintf("- %s, %s is predicted\n", c, c.Productions[0])
+	}
+	result += "\n"
+	return result
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// the expressions of earleySymbols without left recursion
+func createLLRules() []*SyntaxRule[int] {
+	binary := func(op func(a, b int) int) func([]Value[int]) (int, error) {
+		return func(vals []Value[int]) (int, error) {
+			return op(vals[len(vals)-2].Val, vals[len(vals)-1].Val), nil
+		}
+	}
+	constant := func(c int) func([]Value[int]) (int, error) {
+		return func(vals []Value[int]) (int, error) {
+			return c, nil
+		}
+	}
+	add := func(a, b int) int { return a + b }
+	mul := func(a, b int) int { return a * b }
+	return []*SyntaxRule[int]{
+		{
+			Name: "expr",
+			Expand: []*RuleOps[int]{
+				{Ops: "term sum", RFunc: binary(add)},
+			},
+		},
+		{
+			Name: "sum",
+			Expand: []*RuleOps[int]{
+				{Ops: "PLUS term sum", RFunc: binary(add)},
+				{Ops: "", RFunc: constant(0)},
+			},
+		},
+		{
+			Name: "term",
+			Expand: []*RuleOps[int]{
+				{Ops: "factor product", RFunc: binary(mul)},
+			},
+		},
+		{
+			Name: "product",
+			Expand: []*RuleOps[int]{
+				{Ops: "TIMES factor product", RFunc: binary(mul)},
+				{Ops: "", RFunc: constant(1)},
+			},
+		},
+		{
+			Name: "factor",
+			Expand: []*RuleOps[int]{
+				{
+					Ops: "NUMBER",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return strconv.Atoi(vals[0].Token.Value)
+					},
+				},
+				{
+					Ops: "LPAREN expr RPAREN",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return vals[1].Val, nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestLLTable(t *testing.T) {
+	p := CreateLLParser(earleySymbols, []string{" "}, createLLRules(), []*Precedence{})
+	if len(p.Conflicts()) != 0 {
+		t.Errorf("Expected no conflict, got %v", p.Conflicts())
+	}
+
+	g := p.parser.grammar
+	predict := func(nonterminal string, term string) string {
+		result := make([]string, 0)
+		for _, id := range p.table.predict[nonterminal][term] {
+			result = append(result, productionString(g.productions[id]))
+		}
+		return strings.Join(result, ", ")
+	}
+	expected := map[[2]string]string{
+		{"expr", "LPAREN"}:  "expr -> term sum",
+		{"sum", "PLUS"}:     "sum -> PLUS term sum",
+		{"sum", "RPAREN"}:   "sum -> <empty>",
+		{"sum", ENDTOKEN}:   "sum -> <empty>",
+		{"product", "PLUS"}: "product -> <empty>",
+		{"factor", "TIMES"}: "",
+	}
+	for cell, e := range expected {
+		if got := predict(cell[0], cell[1]); got != e {
+			t.Errorf("Expected %s for %v, got %s", e, cell, got)
+		}
+	}
+}
+
+func TestLLConflicts(t *testing.T) {
+	p := CreateLLParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	conflicts := p.Conflicts()
+	if len(conflicts) != 4 {
+		t.Fatalf("Expected 4 conflicts, got %v", conflicts)
+	}
+	c := conflicts[0]
+	if c.Kind != FirstFirst || c.Nonterminal != "expr" || c.Productions[0] != "expr -> expr PLUS term" {
+		t.Errorf("Unexpected conflict %s", c)
+	}
+	if _, err := p.Parse("1 + 2"); err == nil || !strings.Contains(err.Error(), "left recursion of expr") {
+		t.Errorf("Expected a left recursion, got %v", err)
+	}
+
+	// the dangling else
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "stmt",
+			Expand: []*RuleOps[any]{
+				{Ops: "IF NAME THEN stmt tail"},
+				{Ops: "NAME"},
+			},
+		},
+		{
+			Name: "tail",
+			Expand: []*RuleOps[any]{
+				{Ops: "ELSE stmt"},
+				{Ops: ""},
+			},
+		},
+	}
+	ifElse := CreateLLParser(conflictSymbols, []string{" "}, rules, []*Precedence{})
+	conflicts = ifElse.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Kind != FirstFollow || conflicts[0].Lookahead != "ELSE" {
+		t.Fatalf("Expected a FIRST/FOLLOW conflict on ELSE, got %v", conflicts)
+	}
+	// the else goes with the nearest if
+	tree, err := ifElse.ParseTree("if a then if b then c else d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "(stmt IF:if NAME:a THEN:then (stmt IF:if NAME:b THEN:then (stmt NAME:c) (tail ELSE:else (stmt NAME:d))) (tail))"
+	if tree.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, tree)
+	}
+}
+
+func TestLLParser(t *testing.T) {
+	lr := CreateParser(earleySymbols, []string{" "}, createLLRules(), []*Precedence{})
+	ll := CreateLLParser(earleySymbols, []string{" "}, createLLRules(), []*Precedence{})
+
+	for _, s := range []string{"7", "1 + 2 * 3", "(1 + 2) * 3 + 4 * (5 + 6)"} {
+		expected, err := lr.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ll.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != expected {
+			t.Errorf("Expected %d for %s, got %d", expected, s, result)
+		}
+
+		expectedTree, _ := lr.ParseTree(s)
+		tree, err := ll.ParseTree(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.String() != expectedTree.String() || tree.Span != expectedTree.Span {
+			t.Errorf("Expected %s, got %s", expectedTree, tree)
+		}
+	}
+
+	for _, s := range []string{"1 + * 2", "(1 + 2", "1 2"} {
+		if _, err := ll.Parse(s); err == nil || !strings.Contains(err.Error(), "syntax error") {
+			t.Errorf("Expected a syntax error for %s, got %v", s, err)
+		}
+	}
+}
+
+func TestLLMD(t *testing.T) {
+	dir := t.TempDir()
+	p := CreateLLParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	p.WriteMDInfo("ll", dir)
+
+	content, err := os.ReadFile(filepath.Join(dir, "ll.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(content)
+	for _, s := range []string{
+		"# LL(1) Table",
+		"| Nonterminal | $end | LPAREN | NUMBER | PLUS | RPAREN | TIMES |",
+		"| expr |  | [P1](#P1), [P2](#P2) | [P1](#P1), [P2](#P2) |",
+		"- FIRST/FIRST conflict of expr on LPAREN between expr -> expr PLUS term and expr -> term, expr -> expr PLUS term is predicted",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("Expected %s in\n%s", s, md)
+		}
+	}
+
+	// the report of the LR parser tells whether the grammar is LL(1) too
+	CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{}).WriteMDInfo("lr", dir)
+	content, err = os.ReadFile(filepath.Join(dir, "lr.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "# LL(1) Table") ||
+		!strings.Contains(string(content), "FIRST/FIRST conflict of expr on LPAREN") {
+		t.Errorf("Expected the LL(1) table in the LR report")
+	}
+}
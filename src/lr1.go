@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The method building the states and the lookaheads of the LR table
+type TableMethod int
+
+const (
+	// LALR(1) by DeRemer and Pennello, the default
+	LALR1 TableMethod = iota
+	// canonical LR(1), which never merges the states with the same core
+	LR1
+	// SLR(1), the LR(0) states reducing on the FOLLOW sets
+	SLR1
+	// LR(0), the LR(0) states reducing on any lookahead
+	LR0
+	// minimal LR(1) by Pager, which merges the LR(1) states with the same
+	// core unless the merge makes a reduce/reduce conflict
+	MinimalLR1
+)
+
+func (m TableMethod) apply(c *parserConfig) {
+	c.method = m
+}
+
+func (m TableMethod) String() string {
+	switch m {
+	case LALR1:
+		return "LALR(1)"
+	case LR1:
+		return "LR(1)"
+	case SLR1:
+		return "SLR(1)"
+	case LR0:
+		return "LR(0)"
+	case MinimalLR1:
+		return "minimal LR(1)"
+	}
+	return fmt.Sprintf("TableMethod(%d)", int(m))
+}
+
+// whether the method builds the LR(0) states
+func (m TableMethod) lr0States() bool {
+	return m != LR1 && m != MinimalLR1
+}
+
+// A state of the LR(1) automaton: its kernel items with their lookaheads,
+// and its closure, i.e. the items in the order of the closure with the
+// lookaheads of each item.
+type lr1State struct {
+	kernel     []*LRItem
+	kernelLas  map[*LRItem]*StrSet
+	items      []*LRItem
+	lookaheads map[*LRItem]*StrSet
+	symbols    []string // the symbols of the transitions, in the order of the items
+}
+
+// Build the LR(1) states, their transitions and the lookaheads of their
+// items. In canonical LR(1), two states are the same if they have the same
+// kernel items with the same lookaheads. In minimal LR(1), by Pager's weak
+// compatibility, a new state is merged into a state with the same core if
+// the merge can not make a reduce/reduce conflict, and the merged state is
+// processed again to propagate its new lookaheads.
+func (self *lrTable) lr1Items(minimal bool) {
+	g := self.grammar
+	states := make([]*lr1State, 0)
+	transitions := make([]map[string]int, 0)
+	index := make(map[string][]int)
+	queue := make([]int, 0)
+	queued := make(map[int]bool)
+
+	push := func(id int) {
+		if !queued[id] {
+			queued[id] = true
+			queue = append(queue, id)
+		}
+	}
+
+	findState := func(kernel []*LRItem, lookaheads map[*LRItem]*StrSet) int {
+		var key string
+		if minimal {
+			key = lr1Key(kernel, nil)
+		} else {
+			key = lr1Key(kernel, lookaheads)
+		}
+
+		for _, id := range index[key] {
+			state := states[id]
+			if !minimal {
+				return id
+			}
+			if !weaklyCompatible(state.kernel, state.kernelLas, lookaheads) {
+				continue
+			}
+			grown := false
+			for _, item := range state.kernel {
+				lookaheads[item].forEach(func(s string) {
+					if !state.kernelLas[item].contains(s) {
+						state.kernelLas[item].add(s)
+						grown = true
+					}
+				})
+			}
+			if grown {
+				push(id)
+			}
+			return id
+		}
+
+		id := len(states)
+		state := &lr1State{
+			kernel:    kernel,
+			kernelLas: make(map[*LRItem]*StrSet),
+		}
+		for _, item := range kernel {
+			state.kernelLas[item] = createSet()
+			state.kernelLas[item].addSet(lookaheads[item])
+		}
+		states = append(states, state)
+		transitions = append(transitions, make(map[string]int))
+		index[key] = append(index[key], id)
+		push(id)
+		return id
+	}
+
+	start := g.productions[0].lrNext
+	findState([]*LRItem{start}, map[*LRItem]*StrSet{start: createSet()})
+
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		queued[i] = false
+
+		state := states[i]
+		self.lr1Closure(state)
+
+		// the kernels of the successors
+		kernels := make(map[string][]*LRItem)
+		lookaheads := make(map[string]map[*LRItem]*StrSet)
+		for _, sym := range state.symbols {
+			lookaheads[sym] = make(map[*LRItem]*StrSet)
+		}
+		for _, item := range state.items {
+			if (item.lrIndex + 1) == item.len {
+				continue
+			}
+			front := (*item.prod)[item.lrIndex+1]
+			next := item.lrNext
+			if _, ok := lookaheads[front][next]; !ok {
+				kernels[front] = append(kernels[front], next)
+				lookaheads[front][next] = createSet()
+			}
+			lookaheads[front][next].addSet(state.lookaheads[item])
+		}
+
+		for _, sym := range state.symbols {
+			transitions[i][sym] = findState(kernels[sym], lookaheads[sym])
+		}
+	}
+
+	// Renumber the states reachable from the start state, in the order of
+	// the transitions. A state left by the reprocessing of its predecessor
+	// in minimal LR(1) is dropped.
+	order := []int{0}
+	renumber := map[int]int{0: 0}
+	for i := 0; i < len(order); i++ {
+		old := order[i]
+		for _, sym := range states[old].symbols {
+			next := transitions[old][sym]
+			if _, ok := renumber[next]; !ok {
+				renumber[next] = len(order)
+				order = append(order, next)
+			}
+		}
+	}
+
+	self.closures = make([][]*LRItem, len(order))
+	for i, old := range order {
+		state := states[old]
+		self.closures[i] = state.items
+		for _, item := range state.items {
+			self.itemLookaheads(item, i).addSet(state.lookaheads[item])
+		}
+		trans := make(map[string]int)
+		for _, sym := range state.symbols {
+			trans[sym] = renumber[transitions[old][sym]]
+		}
+		self.transitions[i] = trans
+	}
+}
+
+// Pager's weak compatibility of the lookaheads of two states with the same
+// kernel: for each pair of items i, j, either the lookaheads of i in one state
+// and j in the other are disjoint, or i and j already share a lookahead in one
+// of the states.
+func weaklyCompatible(kernel []*LRItem, las1 map[*LRItem]*StrSet, las2 map[*LRItem]*StrSet) bool {
+	for i := 0; i < len(kernel); i++ {
+		for j := i + 1; j < len(kernel); j++ {
+			a, b := kernel[i], kernel[j]
+			if !intersects(las1[a], las2[b]) && !intersects(las2[a], las1[b]) {
+				continue
+			}
+			if intersects(las1[a], las1[b]) || intersects(las2[a], las2[b]) {
+				continue
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func intersects(a *StrSet, b *StrSet) bool {
+	for s := range a.set {
+		if b.contains(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compute the LR(1) closure of the kernel of the state: an item A -> a . B b
+// with lookahead x adds the items B -> . c with the lookaheads FIRST(b x).
+func (self *lrTable) lr1Closure(state *lr1State) {
+	g := self.grammar
+	state.items = make([]*LRItem, 0)
+	state.lookaheads = make(map[*LRItem]*StrSet)
+	for _, item := range state.kernel {
+		state.items = append(state.items, item)
+		state.lookaheads[item] = createSet()
+		state.lookaheads[item].addSet(state.kernelLas[item])
+	}
+
+	queue := append([]*LRItem{}, state.kernel...)
+	for len(queue) > 0 {
+		item := queue[0]
+		queue = queue[1:]
+		if (item.lrIndex + 1) == item.len {
+			continue
+		}
+
+		prod := g.productions[item.number].prod
+		front := prod[item.lrIndex]
+		if _, ok := g.nonterminals[front]; !ok {
+			continue
+		}
+
+		rest := prod[item.lrIndex+1:]
+		first := g.getFirstFromProd(&rest)
+		heads := createSet()
+		first.forEach(func(s string) {
+			if s != EMPTYTOKEN {
+				heads.add(s)
+			}
+		})
+		if first.contains(EMPTYTOKEN) {
+			heads.addSet(state.lookaheads[item])
+		}
+
+		for _, p := range g.prodNames[front] {
+			next := p.lrNext
+			old, ok := state.lookaheads[next]
+			if !ok {
+				old = createSet()
+				state.items = append(state.items, next)
+				state.lookaheads[next] = old
+			}
+			grown := !ok
+			heads.forEach(func(s string) {
+				if !old.contains(s) {
+					old.add(s)
+					grown = true
+				}
+			})
+			if grown {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	state.symbols = make([]string, 0)
+	seen := createSet()
+	for _, item := range state.items {
+		if (item.lrIndex + 1) == item.len {
+			continue
+		}
+		front := (*item.prod)[item.lrIndex+1]
+		if !seen.contains(front) {
+			seen.add(front)
+			state.symbols = append(state.symbols, front)
+		}
+	}
+}
+
+// key of the kernel of a LR(1) state, or of its core if lookaheads is nil
+func lr1Key(kernel []*LRItem, lookaheads map[*LRItem]*StrSet) string {
+	keys := make([]string, 0, len(kernel))
+	for _, item := range kernel {
+		if lookaheads == nil {
+			keys = append(keys, fmt.Sprintf("%d.%d", item.number, item.lrIndex))
+			continue
+		}
+		heads := make([]string, 0)
+		lookaheads[item].forEach(func(s string) {
+			heads = append(heads, s)
+		})
+		sort.Strings(heads)
+		keys = append(keys, fmt.Sprintf("%d.%d{%s}", item.number, item.lrIndex, strings.Join(heads, ",")))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
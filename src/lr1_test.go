@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// LR(1) but not LALR(1): merging the states of E -> e . and F -> e . makes a
+// reduce/reduce conflict on c and d
+func createLR1Rules() []*SyntaxRule[string] {
+	concat := func(vals []Value[string]) (string, error) {
+		result := ""
+		for _, v := range vals {
+			if v.Token != nil {
+				result += v.Token.Value
+			} else {
+				result += v.Val
+			}
+		}
+		return result, nil
+	}
+
+	return []*SyntaxRule[string]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[string]{
+				{Ops: "A e C", RFunc: concat},
+				{Ops: "A f D", RFunc: concat},
+				{Ops: "B f C", RFunc: concat},
+				{Ops: "B e D", RFunc: concat},
+			},
+		},
+		{
+			Name: "e",
+			Expand: []*RuleOps[string]{
+				{
+					Ops: "X",
+					RFunc: func(vals []Value[string]) (string, error) {
+						return "E", nil
+					},
+				},
+			},
+		},
+		{
+			Name: "f",
+			Expand: []*RuleOps[string]{
+				{
+					Ops: "X",
+					RFunc: func(vals []Value[string]) (string, error) {
+						return "F", nil
+					},
+				},
+			},
+		},
+	}
+}
+
+var lr1Symbols = map[string]string{
+	"A": "a",
+	"B": "b",
+	"C": "c",
+	"D": "d",
+	"X": "x",
+}
+
+func TestLR1(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, LR1)
+
+	expected := map[string]string{
+		"a x c": "aEc",
+		"a x d": "aFd",
+		"b x c": "bFc",
+		"b x d": "bEd",
+	}
+	for input, want := range expected {
+		result, err := p.Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want {
+			t.Errorf("Expected %s for %s, got %s", want, input, result)
+		}
+	}
+
+	lalr := buildLRTable(p.grammar, LALR1)
+	if len(p.table.closures) <= len(lalr.closures) {
+		t.Errorf("Expected more LR(1) states than the %d LALR(1) ones, got %d", len(lalr.closures), len(p.table.closures))
+	}
+	if _, rr := lalr.countConflicts(); rr != 2 {
+		t.Errorf("Expected 2 reduce/reduce conflicts in LALR(1), got %d", rr)
+	}
+
+	dir := t.TempDir()
+	p.WriteMDInfo("lr1", dir)
+	md, err := os.ReadFile(filepath.Join(dir, "lr1.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(md), "## Conflicts only in LALR(1)") ||
+		!strings.Contains(string(md), "reduce/reduce on C between e -> X . and f -> X .") {
+		t.Errorf("Expected the LALR(1) conflicts in the report")
+	}
+}
+
+func TestLALRConflict(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{})
+	conflicts := p.Conflicts()
+	if len(conflicts) != 2 {
+		t.Fatalf("Expected 2 reduce/reduce conflicts of LALR(1), got %d", len(conflicts))
+	}
+	for _, c := range conflicts {
+		if c.Kind != ReduceReduce || c.Resolution != "reduce e -> X" {
+			t.Errorf("Unexpected conflict %s", c)
+		}
+		// the grammar is not ambiguous
+		if c.Counterexample == nil || c.Counterexample.Unifying {
+			t.Errorf("Expected a nonunifying counterexample for %s", c)
+		}
+	}
+}
+
+func TestLR1Calc(t *testing.T) {
+	lalr := createCalc()
+	lr1 := createCalc(LR1)
+
+	for _, input := range []string{"1 + 2 * 3", "-(4 - 6) * 2 / 4", "(1 + 2) * -3 - 4"} {
+		want, err := lalr.parser.Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := lr1.parser.Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != want {
+			t.Errorf("Expected %d for %s, got %d", want, input, result)
+		}
+	}
+}
+
+// LALR(1) but not SLR(1): EQ is in FOLLOW(r), so SLR(1) can reduce r -> l .
+// where only the shift of EQ is valid
+func createAssignParser(opts ...Option) *Parser[any] {
+	symbols := map[string]string{
+		"ID":   "[a-z]+",
+		"EQ":   "=",
+		"STAR": "\\*",
+	}
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "l EQ r"},
+				{Ops: "r"},
+			},
+		},
+		{
+			Name: "l",
+			Expand: []*RuleOps[any]{
+				{Ops: "STAR r"},
+				{Ops: "ID"},
+			},
+		},
+		{
+			Name: "r",
+			Expand: []*RuleOps[any]{
+				{Ops: "l"},
+			},
+		},
+	}
+	return CreateParser(symbols, []string{" "}, rules, []*Precedence{}, opts...)
+}
+
+func TestSLRAndLR0(t *testing.T) {
+	lalr := createAssignParser()
+	slr := createAssignParser(SLR1)
+
+	if sr, _ := lalr.table.countConflicts(); sr != 0 {
+		t.Errorf("Expected no conflict in LALR(1), got %d", sr)
+	}
+	if sr, _ := slr.table.countConflicts(); sr != 1 {
+		t.Errorf("Expected 1 shift/reduce conflict in SLR(1), got %d", sr)
+	}
+	if len(slr.table.closures) != len(lalr.table.closures) {
+		t.Errorf("Expected the same LR(0) states")
+	}
+	// the shift wins the conflict
+	for _, input := range []string{"*x = y", "**x"} {
+		if _, err := slr.ParseTree(input); err != nil {
+			t.Errorf("Unexpected error for %s: %v", input, err)
+		}
+	}
+
+	dir := t.TempDir()
+	lalr.WriteMethodsMD("methods", dir, SLR1, LR0, LR1)
+	data, err := os.ReadFile(filepath.Join(dir, "methods.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(data)
+	for _, want := range []string{
+		"## LALR(1) and SLR(1)",
+		"### Conflicts only in SLR(1)\n\n- S",
+		"shift/reduce on EQ with r -> l .",
+		"| S2 | EQ | s7 | s7 (conflict) |",
+		"## LALR(1) and LR(0)",
+		"## LALR(1) and LR(1)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected %q in the report", want)
+		}
+	}
+	if strings.Contains(md[strings.Index(md, "## LALR(1) and LR(1)"):], "Different Actions") {
+		t.Errorf("Expected no action comparison with the LR(1) states")
+	}
+}
+
+func TestMinimalLR1(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, MinimalLR1)
+	for _, input := range []string{"a x c", "a x d", "b x c", "b x d"} {
+		if _, err := p.Parse(input); err != nil {
+			t.Errorf("Unexpected error for %s: %v", input, err)
+		}
+	}
+
+	// only the state of e -> X . and f -> X . is split
+	lalr := buildLRTable(p.grammar, LALR1)
+	if len(p.table.closures) != len(lalr.closures)+1 {
+		t.Errorf("Expected %d states, got %d", len(lalr.closures)+1, len(p.table.closures))
+	}
+
+	// no state of the calculator needs to be split
+	calc := createCalc(MinimalLR1)
+	lalr = buildLRTable(calc.parser.grammar, LALR1)
+	canonical := buildLRTable(calc.parser.grammar, LR1)
+	if len(calc.parser.table.closures) != len(lalr.closures) {
+		t.Errorf("Expected the %d LALR(1) states, got %d", len(lalr.closures), len(calc.parser.table.closures))
+	}
+	if len(canonical.closures) <= len(lalr.closures) {
+		t.Errorf("Expected more canonical LR(1) states than %d, got %d", len(lalr.closures), len(canonical.closures))
+	}
+	result, err := calc.parser.Parse("-(1 + 2) * 3 - 4 / 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != -11 {
+		t.Errorf("Expected -11, got %d", result)
+	}
+}
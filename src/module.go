@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A grammar module is a set of rules which can be imported into other
+// modules. The nonterminals of an imported module are namespaced by the name
+// of the import, e.g. the rule expr of a module imported as arith is
+// arith.expr in the importing module. The terminals are shared, since all the
+// modules are parsed by the same lexer.
+type Module[T any] struct {
+	Rules      []*SyntaxRule[T]
+	Precedence []*Precedence
+	Imports    []*Import[T]
+	// Alternatives added to the imported rules, e.g. a rule arith.expr whose
+	// ops are written in the scope of this module.
+	Extend []*SyntaxRule[T]
+	// Imported rules whose alternatives are replaced.
+	Override []*SyntaxRule[T]
+}
+
+type Import[T any] struct {
+	Module *Module[T]
+	As     string
+}
+
+// Flatten the module and its imports into the rules and the precedence for
+// CreateParser. The first rule of the module is the start rule.
+func (m *Module[T]) Compose() ([]*SyntaxRule[T], []*Precedence) {
+	rules, levels := m.compose()
+
+	precs := make([]*Precedence, 0)
+	byLevel := make(map[int]*Precedence)
+	for _, t := range levels.order {
+		level := levels.level[t]
+		p, ok := byLevel[level]
+		if !ok {
+			p = &Precedence{
+				TokenType: make([]string, 0),
+				Level:     level,
+			}
+			byLevel[level] = p
+			precs = append(precs, p)
+		}
+		p.TokenType = append(p.TokenType, t)
+	}
+
+	return rules, precs
+}
+
+// precedence merged from the modules, with the module which set each level
+type mergedPrecedence struct {
+	level  map[string]int
+	origin map[string]string
+	order  []string
+}
+
+// Returns the rules and the precedence of the module, with the names of the
+// rules relative to the module.
+func (m *Module[T]) compose() ([]*SyntaxRule[T], *mergedPrecedence) {
+	levels := &mergedPrecedence{
+		level:  make(map[string]int),
+		origin: make(map[string]string),
+		order:  make([]string, 0),
+	}
+	for _, p := range m.Precedence {
+		for _, t := range p.TokenType {
+			levels.merge(t, p.Level, "")
+		}
+	}
+
+	own := make(map[string]*SyntaxRule[T])
+	rules := make([]*SyntaxRule[T], 0)
+	for _, rule := range m.Rules {
+		if strings.Contains(rule.Name, ".") {
+			panic(fmt.Sprintf("rule %s can not be namespaced, use Extend or Override", rule.Name))
+		}
+		if _, ok := own[rule.Name]; ok {
+			panic(fmt.Sprintf("duplicate rule %s", rule.Name))
+		}
+		own[rule.Name] = rule
+		rules = append(rules, rule)
+	}
+
+	imported := make(map[string]*SyntaxRule[T])
+	importedRules := make([]*SyntaxRule[T], 0)
+	namespaces := make(map[string]bool)
+	for _, imp := range m.Imports {
+		if imp.As == "" || strings.ContainsAny(imp.As, ". ") {
+			panic(fmt.Sprintf("invalid namespace \"%s\"", imp.As))
+		}
+		if namespaces[imp.As] {
+			panic(fmt.Sprintf("duplicate namespace %s", imp.As))
+		}
+		if _, ok := own[imp.As]; ok {
+			panic(fmt.Sprintf("namespace %s has the same name as a rule", imp.As))
+		}
+		namespaces[imp.As] = true
+
+		subRules, subLevels := imp.Module.compose()
+		names := createSet()
+		for _, rule := range subRules {
+			names.add(rule.Name)
+		}
+		for _, rule := range subRules {
+			q := qualifyRule(rule, imp.As, names)
+			imported[q.Name] = q
+			importedRules = append(importedRules, q)
+		}
+
+		for _, t := range subLevels.order {
+			origin := imp.As
+			if subLevels.origin[t] != "" {
+				origin += "." + subLevels.origin[t]
+			}
+			levels.merge(t, subLevels.level[t], origin)
+		}
+	}
+
+	for _, rule := range m.Override {
+		target, ok := imported[rule.Name]
+		if !ok {
+			panic(fmt.Sprintf("override of %s which is not imported", rule.Name))
+		}
+		if len(rule.Params) != len(target.Params) {
+			panic(fmt.Sprintf("override of %s changes its parameters", rule.Name))
+		}
+		target.Expand = append([]*RuleOps[T]{}, rule.Expand...)
+	}
+	for _, rule := range m.Extend {
+		target, ok := imported[rule.Name]
+		if !ok {
+			panic(fmt.Sprintf("extension of %s which is not imported", rule.Name))
+		}
+		if len(rule.Params) != 0 || len(target.Params) != 0 {
+			panic(fmt.Sprintf("extension of template %s", rule.Name))
+		}
+		target.Expand = append(target.Expand, rule.Expand...)
+	}
+
+	return append(rules, importedRules...), levels
+}
+
+// Two modules may set the same level for a token, but not different ones.
+func (mp *mergedPrecedence) merge(t string, level int, origin string) {
+	if old, ok := mp.level[t]; ok {
+		if old != level {
+			panic(fmt.Sprintf("precedence conflict for token type %s: level %d in %s, level %d in %s",
+				t, old, moduleName(mp.origin[t]), level, moduleName(origin)))
+		}
+		return
+	}
+	mp.level[t] = level
+	mp.origin[t] = origin
+	mp.order = append(mp.order, t)
+}
+
+func moduleName(origin string) string {
+	if origin == "" {
+		return "the importing module"
+	}
+	return "module " + origin
+}
+
+// Copy the rule into the namespace ns. The names are those of the rules of
+// the imported module, the other symbols are terminals or templates of the
+// importing module and are kept.
+func qualifyRule[T any](rule *SyntaxRule[T], ns string, names *StrSet) *SyntaxRule[T] {
+	params := createSet()
+	params.addArr(rule.Params)
+
+	q := &SyntaxRule[T]{
+		Name:   ns + "." + rule.Name,
+		Params: rule.Params,
+		Expand: make([]*RuleOps[T], 0, len(rule.Expand)),
+	}
+	for _, ops := range rule.Expand {
+		syms := expStr2Arr(ops.Ops)
+		for i, sym := range syms {
+			label := ""
+			eq := strings.Index(sym, "=")
+			if eq >= 0 && !strings.Contains(sym[:eq], "(") {
+				label = sym[:eq+1]
+				sym = sym[eq+1:]
+			}
+			syms[i] = label + qualifySymbol(sym, ns, names, params)
+		}
+
+		qOps := *ops
+		qOps.Ops = strings.Join(syms, " ")
+		q.Expand = append(q.Expand, &qOps)
+	}
+	return q
+}
+
+func qualifySymbol(sym string, ns string, names *StrSet, params *StrSet) string {
+	if isTemplateCall(sym) {
+		name, args := splitTemplateCall(sym)
+		for i, arg := range args {
+			args[i] = qualifySymbol(arg, ns, names, params)
+		}
+		return joinTemplateCall(qualifySymbol(name, ns, names, params), args)
+	}
+
+	if names.contains(sym) && !params.contains(sym) {
+		return ns + "." + sym
+	}
+	return sym
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+var moduleSymbols = map[string]string{
+	"NAME[PRINT]": "print",
+	"NAME":        "[a-zA-Z_][a-zA-Z0-9_]*",
+	"NUMBER":      "[0-9]+",
+	"PLUS":        "\\+",
+	"MULTIPLY":    "\\*",
+	"LPAREN":      "\\(",
+	"RPAREN":      "\\)",
+	"COMMA":       ",",
+	"SEMI":        ";",
+}
+
+// the shared expression sub-language
+func createArithModule() *Module[int] {
+	binary := func(op func(int, int) int) func(ctx *ActionCtx[int]) (int, error) {
+		return func(ctx *ActionCtx[int]) (int, error) {
+			return op(ctx.Val("lhs"), ctx.Val("rhs")), nil
+		}
+	}
+
+	return &Module[int]{
+		Rules: []*SyntaxRule[int]{
+			{
+				Name: "expr",
+				Expand: []*RuleOps[int]{
+					{
+						Ops:    "lhs=expr PLUS rhs=expr",
+						Refs:   []string{"lhs", "rhs"},
+						Action: binary(func(a, b int) int { return a + b }),
+					},
+					{
+						Ops:    "lhs=expr MULTIPLY rhs=expr",
+						Refs:   []string{"lhs", "rhs"},
+						Action: binary(func(a, b int) int { return a * b }),
+					},
+					{
+						Ops: "atom",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return vals[0].Val, nil
+						},
+					},
+				},
+			},
+			{
+				Name: "atom",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "NUMBER",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return strconv.Atoi(vals[0].Token.Value)
+						},
+					},
+					{
+						Ops: "parens(expr)",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return vals[0].Val, nil
+						},
+					},
+				},
+			},
+			{
+				Name:   "parens",
+				Params: []string{"X"},
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "LPAREN X RPAREN",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return vals[1].Val, nil
+						},
+					},
+				},
+			},
+		},
+		Precedence: []*Precedence{
+			{TokenType: []string{"PLUS"}, Level: 1},
+			{TokenType: []string{"MULTIPLY"}, Level: 2},
+		},
+	}
+}
+
+// print statements over the imported expressions, with variables added to
+// the imported atoms
+func createPrintModule(vars map[string]int) *Module[int] {
+	return &Module[int]{
+		Rules: []*SyntaxRule[int]{
+			{
+				Name: "program",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "list(statement)",
+						RFunc: func(vals []Value[int]) (int, error) {
+							sum := 0
+							for _, item := range vals[0].Items {
+								sum += item.Val
+							}
+							return sum, nil
+						},
+					},
+				},
+			},
+			{
+				Name: "statement",
+				Expand: []*RuleOps[int]{
+					{
+						Ops:  "PRINT value=arith.expr SEMI",
+						Refs: []string{"value"},
+						Action: func(ctx *ActionCtx[int]) (int, error) {
+							return ctx.Val("value"), nil
+						},
+					},
+				},
+			},
+		},
+		Imports: []*Import[int]{
+			{Module: createArithModule(), As: "arith"},
+		},
+		Extend: []*SyntaxRule[int]{
+			{
+				Name: "arith.atom",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "NAME",
+						RFunc: func(vals []Value[int]) (int, error) {
+							num, ok := vars[vals[0].Token.Value]
+							if !ok {
+								return 0, fmt.Errorf("undefined variable: %s", vals[0].Token.Value)
+							}
+							return num, nil
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestModuleImport(t *testing.T) {
+	vars := map[string]int{"x": 10}
+	rules, precs := createPrintModule(vars).Compose()
+	for _, rule := range rules {
+		for _, ops := range rule.Expand {
+			fmt.Printf("%s -> %s\n", rule.Name, ops.Ops)
+		}
+	}
+	if rules[0].Name != "program" || rules[2].Name != "arith.expr" {
+		t.Errorf("Unexpected order of rules")
+	}
+	if rules[3].Expand[1].Ops != "arith.parens(arith.expr)" {
+		t.Errorf("Unexpected qualified ops %s", rules[3].Expand[1].Ops)
+	}
+	if len(precs) != 2 {
+		t.Errorf("Expected 2 precedence levels, got %d", len(precs))
+	}
+
+	p := CreateParser(moduleSymbols, []string{" "}, rules, precs)
+	result, err := p.Parse("print 1 + 2 * 3; print (x + 1) * 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != 29 {
+		t.Errorf("Expected 29, got %d", result)
+	}
+}
+
+func TestModuleOverride(t *testing.T) {
+	// a nested import, whose atoms are overridden to drop the parentheses
+	calls := &Module[int]{
+		Rules: []*SyntaxRule[int]{
+			{
+				Name: "call",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "NAME LPAREN separated_nonempty_list(COMMA, arith.expr) RPAREN",
+						RFunc: func(vals []Value[int]) (int, error) {
+							result := vals[2].Items[0].Val
+							for _, item := range vals[2].Items {
+								result = max(result, item.Val)
+							}
+							return result, nil
+						},
+					},
+				},
+			},
+		},
+		Imports: []*Import[int]{
+			{Module: createArithModule(), As: "arith"},
+		},
+		Extend: []*SyntaxRule[int]{
+			{
+				Name: "arith.atom",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "call",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return vals[0].Val, nil
+						},
+					},
+				},
+			},
+		},
+	}
+
+	top := &Module[int]{
+		Rules: []*SyntaxRule[int]{
+			{
+				Name: "program",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "fn.arith.expr",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return vals[0].Val, nil
+						},
+					},
+				},
+			},
+		},
+		Imports: []*Import[int]{
+			{Module: calls, As: "fn"},
+		},
+		Override: []*SyntaxRule[int]{
+			{
+				Name: "fn.arith.atom",
+				Expand: []*RuleOps[int]{
+					{
+						Ops: "fn.call",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return vals[0].Val, nil
+						},
+					},
+					{
+						Ops: "NUMBER",
+						RFunc: func(vals []Value[int]) (int, error) {
+							return strconv.Atoi(vals[0].Token.Value)
+						},
+					},
+				},
+			},
+		},
+	}
+
+	rules, precs := top.Compose()
+	p := CreateParser(moduleSymbols, []string{" "}, rules, precs)
+	result, err := p.Parse("max(1, max(2, 5) * 2) + max(3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != 13 {
+		t.Errorf("Expected 13, got %d", result)
+	}
+
+	if _, err := p.Parse("(1 + 2) * 3"); err == nil {
+		t.Errorf("Expected a syntax error for the overridden atom")
+	}
+}
+
+func TestModulePrecedenceConflict(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Errorf("Expected panic for conflicting precedence")
+		}
+		fmt.Println(r)
+	}()
+
+	m := &Module[int]{
+		Rules: createPrintModule(nil).Rules,
+		Precedence: []*Precedence{
+			{TokenType: []string{"PLUS"}, Level: 3},
+		},
+		Imports: []*Import[int]{
+			{Module: createArithModule(), As: "arith"},
+		},
+	}
+	m.Compose()
+}
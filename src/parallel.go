@@ -0,0 +1,183 @@
+package main
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Workers is an Option of the number of goroutines building the LR table,
+// 0 means runtime.GOMAXPROCS. The table does not depend on it.
+type Workers int
+
+func (w Workers) apply(c *parserConfig) {
+	c.workers = int(w)
+}
+
+// The fewest items given to a worker. An item is a state, a transition or a
+// component of the lookaheads, which take microseconds each, so a goroutine
+// for a few of them costs more than it saves: most grammars, and most levels
+// of the digraph, are built in the calling goroutine, and only the large
+// grammars are spread on the workers.
+const parallelMinItems = 64
+
+// Run fn(i) for 0 <= i < n on the workers of the table. fn must only write
+// the results of i, and the results are merged in the order of i by the
+// caller, so the table is the same whatever the scheduling is. A panic of fn
+// is raised again in the calling goroutine.
+func (self *lrTable) parallel(n int, fn func(i int)) {
+	workers := self.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n/parallelMinItems {
+		workers = n / parallelMinItems
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var failed any
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					failOnce.Do(func() {
+						failed = r
+					})
+				}
+			}()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed != nil {
+		panic(failed)
+	}
+}
+
+// Compute F(x) = initial(x) + the F(y) of every x R y, the digraph algorithm
+// of DeRemer and Pennello. The strongly connected components share their set,
+// and the components whose successors are all done are computed in parallel,
+// so each set is built once and does not depend on the scheduling. The sets
+// are read only.
+func (self *lrTable) digraph(nodes []string, initial map[string]*StrSet, relation map[string][]string) map[string]*StrSet {
+	sorted := append([]string{}, nodes...)
+	sort.Strings(sorted)
+	index := make(map[string]int)
+	for i, x := range sorted {
+		index[x] = i
+	}
+
+	// Tarjan's algorithm finds the components after the ones they reach, so
+	// the level of a component is one more than the levels of its successors
+	comp := make([]int, len(sorted))
+	for i := range comp {
+		comp[i] = -1
+	}
+	order := make([]int, len(sorted))
+	low := make([]int, len(sorted))
+	stack := make([]int, 0)
+	members := make([][]int, 0)
+	levels := make([]int, 0)
+	count := 0
+
+	var visit func(x int)
+	visit = func(x int) {
+		count++
+		order[x] = count
+		low[x] = count
+		stack = append(stack, x)
+		for _, y := range relation[sorted[x]] {
+			yi, ok := index[y]
+			if !ok {
+				continue
+			}
+			if order[yi] == 0 {
+				visit(yi)
+			}
+			if comp[yi] < 0 && low[yi] < low[x] {
+				low[x] = low[yi]
+			}
+		}
+		if low[x] != order[x] {
+			return
+		}
+
+		c := len(members)
+		var scc []int
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			comp[top] = c
+			scc = append(scc, top)
+			if top == x {
+				break
+			}
+		}
+		level := 0
+		for _, m := range scc {
+			for _, y := range relation[sorted[m]] {
+				if yi, ok := index[y]; ok && comp[yi] != c && levels[comp[yi]] >= level {
+					level = levels[comp[yi]] + 1
+				}
+			}
+		}
+		members = append(members, scc)
+		levels = append(levels, level)
+	}
+	for x := range sorted {
+		if order[x] == 0 {
+			visit(x)
+		}
+	}
+
+	byLevel := make([][]int, 0)
+	for c, level := range levels {
+		for len(byLevel) <= level {
+			byLevel = append(byLevel, nil)
+		}
+		byLevel[level] = append(byLevel[level], c)
+	}
+
+	sets := make([]*StrSet, len(members))
+	for _, comps := range byLevel {
+		self.parallel(len(comps), func(i int) {
+			c := comps[i]
+			set := createSet()
+			for _, m := range members[c] {
+				if s, ok := initial[sorted[m]]; ok {
+					set.addSet(s)
+				}
+				for _, y := range relation[sorted[m]] {
+					if yi, ok := index[y]; ok && comp[yi] != c {
+						set.addSet(sets[comp[yi]])
+					}
+				}
+			}
+			sets[c] = set
+		})
+	}
+
+	result := make(map[string]*StrSet)
+	for x, name := range sorted {
+		result[name] = sets[comp[x]]
+	}
+	return result
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParallelTables(t *testing.T) {
+	lexer := CreateLexer(cSymbols, []string{" ", "\n"})
+	for _, method := range []TableMethod{LALR1, SLR1} {
+		g := CreateGrammar(lexer, createCRules(), []*Precedence{})
+		one := buildParallelLRTable(g, method, 1)
+		many := buildParallelLRTable(g, method, 8)
+
+		if !reflect.DeepEqual(one.closures, many.closures) || !reflect.DeepEqual(one.transitions, many.transitions) {
+			t.Errorf("%v: expected the same states", method)
+		}
+		if !reflect.DeepEqual(one.lookaheads, many.lookaheads) {
+			t.Errorf("%v: expected the same lookaheads", method)
+		}
+		if !reflect.DeepEqual(one.lrAction, many.lrAction) || !reflect.DeepEqual(one.lrGoto, many.lrGoto) {
+			t.Errorf("%v: expected the same actions and gotos", method)
+		}
+		if !reflect.DeepEqual(one.tables, many.tables) {
+			t.Errorf("%v: expected the same parse tables", method)
+		}
+		if len(one.conflicts) != len(many.conflicts) {
+			t.Fatalf("%v: expected %d conflicts, got %d", method, len(one.conflicts), len(many.conflicts))
+		}
+		for i, c := range one.conflicts {
+			d := many.conflicts[i]
+			if c.state != d.state || c.key() != d.key() || c.winner != d.winner {
+				t.Errorf("%v: expected the conflict %s, got %s", method, c.key(), d.key())
+			}
+		}
+	}
+}
+
+func TestDigraph(t *testing.T) {
+	table := &lrTable{workers: 4}
+	initial := map[string]*StrSet{
+		"a": createSet(),
+		"b": createSet(),
+		"c": createSet(),
+		"d": createSet(),
+	}
+	initial["a"].add("x")
+	initial["b"].add("y")
+	initial["c"].add("z")
+	initial["d"].add("w")
+	// a and b are a cycle which reads c, d is alone
+	relation := map[string][]string{
+		"a": {"b"},
+		"b": {"a", "c"},
+	}
+
+	sets := table.digraph([]string{"d", "c", "b", "a"}, initial, relation)
+	expected := map[string]string{"a": "x y z", "b": "x y z", "c": "z", "d": "w"}
+	for x, e := range expected {
+		if got := strings.Join(sets[x].sorted(), " "); got != e {
+			t.Errorf("Expected %s for %s, got %s", e, x, got)
+		}
+	}
+	if initial["a"].size() != 1 {
+		t.Errorf("Expected the initial sets to be unchanged")
+	}
+}
+
+func TestParallelPanic(t *testing.T) {
+	failure := fmt.Errorf("state 200")
+	defer func() {
+		if r := recover(); r != failure {
+			t.Errorf("Expected the panic of the state 200, got %v", r)
+		}
+	}()
+
+	table := &lrTable{workers: 4}
+	table.parallel(4*parallelMinItems, func(i int) {
+		if i == 200 {
+			panic(failure)
+		}
+	})
+}
+
+// The workers only gain with several CPUs, and the C grammar has enough
+// states for all of them
+func BenchmarkParallelLALRC(b *testing.B) {
+	lexer := CreateLexer(cSymbols, []string{" ", "\n"})
+	g := CreateGrammar(lexer, createCRules(), []*Precedence{})
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buildParallelLRTable(g, LALR1, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The version of the format of the serialized tables, increased whenever the
+// format or the encoding of the tables changes
+const tablesVersion = 1
+
+// the first bytes of the binary format
+const tablesMagic = "GOBLINTB"
+
+// The serialized parse tables, with the hash of the grammar they are built
+// for. The symbols are listed by their numbers.
+type tablesData struct {
+	Version      int      `json:"version"`
+	Grammar      string   `json:"grammar"`
+	Method       string   `json:"method"`
+	Terminals    []string `json:"terminals"`
+	Nonterminals []string `json:"nonterminals"`
+	Action       combData `json:"action"`
+	Goto         combData `json:"goto"`
+	Lhs          []int32  `json:"lhs"`
+	RhsLen       []int32  `json:"rhsLen"`
+}
+
+type combData struct {
+	Defaults []int32 `json:"defaults"`
+	Base     []int32 `json:"base"`
+	Next     []int32 `json:"next"`
+	Check    []int32 `json:"check"`
+}
+
+// The hash of the productions and the precedence of the grammar, which fix
+// the numbering of the symbols and of the productions in the tables, and the
+// resolution of their conflicts
+func (g *grammar) hash() string {
+	var b strings.Builder
+	for _, prod := range g.productions {
+		fmt.Fprintf(&b, "%s -> %s %%prec %d\n", prod.name, strings.Join(prod.prod, " "), prod.precLevel)
+	}
+	terms := make([]string, 0, len(g.terminals))
+	for term := range g.terminals {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	fmt.Fprintf(&b, "%s\n", strings.Join(terms, " "))
+	precs := make([]string, 0, len(g.precedence))
+	for term, level := range g.precedence {
+		precs = append(precs, fmt.Sprintf("%s %d", term, level))
+	}
+	sort.Strings(precs)
+	fmt.Fprintf(&b, "%s\n", strings.Join(precs, ", "))
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *Parser[T]) tablesData() *tablesData {
+	t := p.table.tables
+	byNumber := func(m map[string]int) []string {
+		result := make([]string, len(m))
+		for sym, i := range m {
+			result[i] = sym
+		}
+		return result
+	}
+	comb := func(c *combVector) combData {
+		return combData{Defaults: c.defaults, Base: c.base, Next: c.next, Check: c.check}
+	}
+
+	return &tablesData{
+		Version:      tablesVersion,
+		Grammar:      p.grammar.hash(),
+		Method:       p.table.method.String(),
+		Terminals:    byNumber(t.terminals),
+		Nonterminals: byNumber(t.nonterminals),
+		Action:       comb(t.action),
+		Goto:         comb(t.gotos),
+		Lhs:          t.lhs,
+		RhsLen:       t.rhsLen,
+	}
+}
+
+// Serialize the parse tables in the binary format, to be loaded by
+// LoadParser without building them again
+func (p *Parser[T]) MarshalTables() ([]byte, error) {
+	data := p.tablesData()
+	var buf bytes.Buffer
+	w := &tablesWriter{w: &buf}
+	w.bytes([]byte(tablesMagic))
+	w.int32s([]int32{int32(data.Version)})
+	w.string(data.Grammar)
+	w.string(data.Method)
+	w.strings(data.Terminals)
+	w.strings(data.Nonterminals)
+	for _, c := range []combData{data.Action, data.Goto} {
+		w.int32s(c.Defaults)
+		w.int32s(c.Base)
+		w.int32s(c.Next)
+		w.int32s(c.Check)
+	}
+	w.int32s(data.Lhs)
+	w.int32s(data.RhsLen)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return buf.Bytes(), nil
+}
+
+// Serialize the parse tables in JSON, which LoadParser loads as well
+func (p *Parser[T]) MarshalTablesJSON() ([]byte, error) {
+	return json.Marshal(p.tablesData())
+}
+
+// Create a parser from the tables serialized by MarshalTables or
+// MarshalTablesJSON, instead of building them. The rules and the precedence
+// must be those of the parser which serialized the tables, the rules give
+// the actions of the parser, and the tables of another grammar or another
+// version of the format fail. The loaded parser parses without the LR states,
+// which are built the first time WriteMDInfo, Conflicts or ParseForest need
+// them.
+func LoadParser[T any](tables []byte, lrules map[string]string, ignore []string, srules []*SyntaxRule[T], precedence []*Precedence) (*Parser[T], error) {
+	lexer := CreateLexer(lrules, ignore)
+	// the loaded tables need no LR items, FIRST or FOLLOW sets
+	grammar := defineGrammar(lexer, srules, precedence)
+	return loadTables[T](tables, lexer, grammar)
+}
+
+// Create the parser of the lexer and the grammar from the serialized tables
+func loadTables[T any](tables []byte, lexer *Lexer, grammar *grammar) (*Parser[T], error) {
+	data, err := unmarshalTables(tables)
+	if err != nil {
+		return nil, err
+	}
+	if data.Version != tablesVersion {
+		return nil, fmt.Errorf("tables of version %d, expected version %d", data.Version, tablesVersion)
+	}
+	if data.Grammar != grammar.hash() {
+		return nil, fmt.Errorf("tables are built for another grammar")
+	}
+
+	method := TableMethod(-1)
+	for _, m := range []TableMethod{LALR1, LR1, SLR1, LR0, MinimalLR1} {
+		if m.String() == data.Method {
+			method = m
+		}
+	}
+	if method < 0 {
+		return nil, fmt.Errorf("tables of unknown method %s", data.Method)
+	}
+	if err := data.check(grammar); err != nil {
+		return nil, fmt.Errorf("corrupted parse tables: %w", err)
+	}
+	byName := func(syms []string) map[string]int {
+		result := make(map[string]int, len(syms))
+		for i, sym := range syms {
+			result[sym] = i
+		}
+		return result
+	}
+	comb := func(c combData) *combVector {
+		return &combVector{defaults: c.Defaults, base: c.Base, next: c.Next, check: c.Check}
+	}
+	table := &lrTable{
+		grammar: grammar,
+		method:  method,
+		tables: &parseTables{
+			terminals:    byName(data.Terminals),
+			nonterminals: byName(data.Nonterminals),
+			action:       comb(data.Action),
+			gotos:        comb(data.Goto),
+			lhs:          data.Lhs,
+			rhsLen:       data.RhsLen,
+			denseEntries: len(data.Action.Defaults) * (len(data.Terminals) + len(data.Nonterminals)),
+		},
+	}
+	return newParser[T](lexer, grammar, table), nil
+}
+
+// Check the tables against the grammar whose hash they have, so that the
+// tables of a corrupted file fail here rather than when parsing
+func (data *tablesData) check(g *grammar) error {
+	checkSymbols := func(kind string, syms []string, expected *StrSet) error {
+		seen := createSet()
+		for _, sym := range syms {
+			if !expected.contains(sym) || seen.contains(sym) {
+				return fmt.Errorf("unexpected %s %s", kind, sym)
+			}
+			seen.add(sym)
+		}
+		if seen.size() != expected.size() {
+			return fmt.Errorf("%d %ss, expected %d", seen.size(), kind, expected.size())
+		}
+		return nil
+	}
+	terminals := createSet()
+	terminals.add(ENDTOKEN)
+	for term := range g.terminals {
+		terminals.add(term)
+	}
+	nonterminals := createSet()
+	for _, prod := range g.productions {
+		nonterminals.add(prod.name)
+	}
+	if err := checkSymbols("terminal", data.Terminals, terminals); err != nil {
+		return err
+	}
+	if err := checkSymbols("nonterminal", data.Nonterminals, nonterminals); err != nil {
+		return err
+	}
+
+	if len(data.Lhs) != len(g.productions) || len(data.RhsLen) != len(g.productions) {
+		return fmt.Errorf("%d productions, expected %d", len(data.Lhs), len(g.productions))
+	}
+	for i, prod := range g.productions {
+		lhs := int(data.Lhs[i])
+		if lhs < 0 || lhs >= len(data.Nonterminals) || data.Nonterminals[lhs] != prod.name || int(data.RhsLen[i]) != prod.prodSize {
+			return fmt.Errorf("production %d is not %s", i, productionString(prod))
+		}
+	}
+
+	nStates := len(data.Action.Defaults)
+	checkComb := func(name string, c combData, rows int, valid func(int32) bool) error {
+		if len(c.Defaults) != rows || len(c.Base) != rows || len(c.Next) != len(c.Check) {
+			return fmt.Errorf("%s table of %d rows, expected %d", name, len(c.Base), rows)
+		}
+		for _, base := range c.Base {
+			if base < 0 {
+				return fmt.Errorf("negative base %d in the %s table", base, name)
+			}
+		}
+		for _, values := range [][]int32{c.Defaults, c.Next} {
+			for _, v := range values {
+				if !valid(v) {
+					return fmt.Errorf("entry %d out of range in the %s table", v, name)
+				}
+			}
+		}
+		return nil
+	}
+	validAction := func(a int32) bool {
+		if a > 0 {
+			return int(a)-1 < nStates
+		}
+		return int(-a)-1 < len(g.productions)
+	}
+	validGoto := func(next int32) bool {
+		return next >= -1 && int(next) < nStates
+	}
+	if err := checkComb("action", data.Action, nStates, validAction); err != nil {
+		return err
+	}
+	return checkComb("goto", data.Goto, len(data.Nonterminals), validGoto)
+}
+
+func unmarshalTables(tables []byte) (*tablesData, error) {
+	data := &tablesData{}
+	if len(tables) > 0 && tables[0] == '{' {
+		if err := json.Unmarshal(tables, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	if !bytes.HasPrefix(tables, []byte(tablesMagic)) {
+		return nil, fmt.Errorf("not serialized parse tables")
+	}
+	r := &tablesReader{r: bytes.NewReader(tables[len(tablesMagic):])}
+	if version := r.int32s(); len(version) == 1 {
+		data.Version = int(version[0])
+	}
+	if r.err == nil && data.Version != tablesVersion {
+		return data, nil
+	}
+	data.Grammar = r.string()
+	data.Method = r.string()
+	data.Terminals = r.strings()
+	data.Nonterminals = r.strings()
+	for _, c := range []*combData{&data.Action, &data.Goto} {
+		c.Defaults = r.int32s()
+		c.Base = r.int32s()
+		c.Next = r.int32s()
+		c.Check = r.int32s()
+	}
+	data.Lhs = r.int32s()
+	data.RhsLen = r.int32s()
+	if r.err != nil {
+		return nil, fmt.Errorf("corrupted parse tables: %w", r.err)
+	}
+	return data, nil
+}
+
+// Writes the little endian length prefixed values of the binary format, and
+// keeps the first error
+type tablesWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *tablesWriter) bytes(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *tablesWriter) length(n int) {
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.LittleEndian, uint32(n))
+	}
+}
+
+func (w *tablesWriter) int32s(values []int32) {
+	w.length(len(values))
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.LittleEndian, values)
+	}
+}
+
+func (w *tablesWriter) string(s string) {
+	w.length(len(s))
+	w.bytes([]byte(s))
+}
+
+func (w *tablesWriter) strings(values []string) {
+	w.length(len(values))
+	for _, s := range values {
+		w.string(s)
+	}
+}
+
+type tablesReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *tablesReader) length() int {
+	var n uint32
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.LittleEndian, &n)
+	}
+	// a length can not be more than the bytes left
+	if r.err == nil && int64(n) > int64(r.r.Len()) {
+		r.err = io.ErrUnexpectedEOF
+	}
+	if r.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (r *tablesReader) int32s() []int32 {
+	values := make([]int32, r.length())
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.LittleEndian, values)
+	}
+	return values
+}
+
+func (r *tablesReader) string() string {
+	b := make([]byte, r.length())
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, b)
+	}
+	return string(b)
+}
+
+func (r *tablesReader) strings() []string {
+	values := make([]string, r.length())
+	for i := range values {
+		values[i] = r.string()
+	}
+	return values
+}
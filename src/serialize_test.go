@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadParser(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, LR1)
+	binary, err := p.MarshalTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, err := p.MarshalTablesJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(json, []byte(`"method":"LR(1)"`)) {
+		t.Errorf("Unexpected JSON %s", json)
+	}
+
+	for _, tables := range [][]byte{binary, json} {
+		loaded, err := LoadParser(tables, lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.table.method != LR1 {
+			t.Errorf("Expected the LR(1) method, got %s", loaded.table.method)
+		}
+		for input, want := range map[string]string{"a x c": "aEc", "b x c": "bFc", "b x d": "bEd"} {
+			result, err := loaded.Parse(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != want {
+				t.Errorf("Expected %s for %s, got %s", want, input, result)
+			}
+		}
+		if _, err := loaded.Parse("a x x"); err == nil {
+			t.Errorf("Expected a syntax error")
+		}
+	}
+}
+
+func TestLoadedParserStates(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, LR1)
+	tables, err := p.MarshalTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadParser(tables, lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the report of a method other than LALR(1) compares it with LALR(1),
+	// which needs the states and the prepared grammar
+	dir := t.TempDir()
+	loaded.WriteMDInfo("loaded", dir)
+	p.WriteMDInfo("built", dir)
+	md, err := os.ReadFile(filepath.Join(dir, "loaded.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the symbols of the report are in the order of maps, so only the
+	// sections and the states are compared
+	expected, _ := os.ReadFile(filepath.Join(dir, "built.md"))
+	for _, section := range []string{"# LR Table", "# Table Methods", "# LL(1) Table", "<a id=S"} {
+		if strings.Count(string(md), section) != strings.Count(string(expected), section) {
+			t.Errorf("Expected %d of %s in the report, got\n%s", strings.Count(string(expected), section), section, md)
+		}
+	}
+	if len(loaded.Conflicts()) != len(p.Conflicts()) {
+		t.Errorf("Expected the conflicts of the built parser")
+	}
+}
+
+func TestLoadParserErrors(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, LR1)
+	tables, err := p.MarshalTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another grammar
+	rules := createLR1Rules()
+	rules[0].Expand = rules[0].Expand[:3]
+	if _, err := LoadParser(tables, lr1Symbols, []string{" "}, rules, []*Precedence{}); err == nil ||
+		!strings.Contains(err.Error(), "another grammar") {
+		t.Errorf("Expected an error for another grammar, got %v", err)
+	}
+
+	// another version
+	other := append([]byte{}, tables...)
+	other[len(tablesMagic)+4] = tablesVersion + 1
+	if _, err := LoadParser(other, lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}); err == nil ||
+		!strings.Contains(err.Error(), "version") {
+		t.Errorf("Expected an error for another version, got %v", err)
+	}
+
+	// truncated
+	if _, err := LoadParser(tables[:len(tables)-3], lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}); err == nil {
+		t.Errorf("Expected an error for truncated tables")
+	}
+	if _, err := LoadParser([]byte("tables"), lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}); err == nil {
+		t.Errorf("Expected an error for data which are not tables")
+	}
+}
+
+func TestLoadCorruptedTables(t *testing.T) {
+	p := CreateParser(lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}, LR1)
+	corruptions := map[string]func(data *tablesData){
+		"unknown method":        func(data *tablesData) { data.Method = "LR(2)" },
+		"missing production":    func(data *tablesData) { data.Lhs = data.Lhs[1:] },
+		"wrong lhs":             func(data *tablesData) { data.Lhs[1] = int32(len(data.Nonterminals)) },
+		"wrong rhs length":      func(data *tablesData) { data.RhsLen[1]++ },
+		"unknown terminal":      func(data *tablesData) { data.Terminals[1] = "Z" },
+		"missing nonterminal":   func(data *tablesData) { data.Nonterminals = data.Nonterminals[1:] },
+		"shift out of range":    func(data *tablesData) { data.Action.Next[0] = shiftAction(len(data.Action.Defaults)) },
+		"reduce out of range":   func(data *tablesData) { data.Action.Defaults[0] = reduceAction(len(data.Lhs)) },
+		"goto out of range":     func(data *tablesData) { data.Goto.Next[0] = int32(len(data.Action.Defaults)) },
+		"negative base":         func(data *tablesData) { data.Goto.Base[0] = -1 },
+		"missing action row":    func(data *tablesData) { data.Action.Base = data.Action.Base[1:] },
+		"missing check entries": func(data *tablesData) { data.Goto.Check = data.Goto.Check[1:] },
+	}
+	for name, corrupt := range corruptions {
+		data := &tablesData{}
+		tables, _ := p.MarshalTablesJSON()
+		if err := json.Unmarshal(tables, data); err != nil {
+			t.Fatal(err)
+		}
+		corrupt(data)
+		tables, _ = json.Marshal(data)
+		if _, err := LoadParser(tables, lr1Symbols, []string{" "}, createLR1Rules(), []*Precedence{}); err == nil {
+			t.Errorf("Expected an error for the %s", name)
+		}
+	}
+}
+
+func TestHashPrecedence(t *testing.T) {
+	precs := []*Precedence{{TokenType: []string{"PLUS"}, Level: 1}}
+	p := CreateParser(conflictSymbols, []string{" "}, createAmbiguousRules(), precs, Expect{ShiftReduce: 1})
+	tables, err := p.MarshalTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IF is the last terminal of no rule, so only the precedence of the
+	// terminals tells the grammars apart
+	precs = append(precs, &Precedence{TokenType: []string{"IF"}, Level: 2})
+	if _, err := LoadParser(tables, conflictSymbols, []string{" "}, createAmbiguousRules(), precs); err == nil ||
+		!strings.Contains(err.Error(), "another grammar") {
+		t.Errorf("Expected an error for another precedence, got %v", err)
+	}
+}
+
+func BenchmarkLoadParserC(b *testing.B) {
+	p := CreateParser(cSymbols, []string{" ", "\n"}, createCRules(), []*Precedence{}, Expect{ShiftReduce: 1})
+	tables, err := p.MarshalTables()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadParser(tables, cSymbols, []string{" ", "\n"}, createCRules(), []*Precedence{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
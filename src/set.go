@@ -1,5 +1,7 @@
 package main
 
+import "sort"
+
 type StrSet struct  {
 	set map[string]bool
 }
@@ -64,4 +66,13 @@ func (s *StrSet) string() string {
 	}
 	result += "}"
 	return result
-}
\ No newline at end of file
+}
+
+func (s *StrSet) sorted() []string {
+	result := make([]string, 0, len(s.set))
+	for key := range s.set {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
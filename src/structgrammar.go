@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+)
+
+// An alternative front end: the grammar is declared as annotated structs,
+//
+//	type Assign struct {
+//		Name string `@NAME`
+//		Expr Expr   `ASSIGN @@ SEMI`
+//	}
+//
+// Every struct is a nonterminal whose production is the concatenation of the
+// tags of its fields. The tag is either the whole tag as above, or the value
+// of the goblin key, e.g. `goblin:"ASSIGN @@ SEMI"`, which go vet accepts.
+// In a tag, the symbols are the same as in Ops, plus the captures which
+// populate the field:
+//
+//	@TOKEN  the token, into a string, *Token, int, float64 or bool field
+//	@@      the nonterminal of the type of the field
+//	@@* @@+ @@? (or @TOKEN*...) shorthands of list(@@), nonempty_list(@@) and option(@@)
+//
+// A capture can be the argument of a template, e.g. separated_list(COMMA, @@)
+// into a slice field. An interface is a nonterminal whose alternatives are the
+// struct types declared by Union.
+
+// The struct types implementing an interface, each one is an alternative of
+// the interface in the grammar.
+type UnionDef struct {
+	iface   reflect.Type
+	members []reflect.Type
+}
+
+func Union[I any](members ...I) *UnionDef {
+	iface := reflect.TypeOf((*I)(nil)).Elem()
+	if iface.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("union of %s which is not an interface", iface))
+	}
+
+	u := &UnionDef{
+		iface:   iface,
+		members: make([]reflect.Type, 0),
+	}
+	for _, m := range members {
+		u.members = append(u.members, reflect.TypeOf(m))
+	}
+	return u
+}
+
+// Parser populating the structs of the grammar, T is the root of the grammar.
+type StructParser[T any] struct {
+	parser *Parser[any]
+	rules  []*SyntaxRule[any]
+}
+
+func CreateStructParser[T any](lrules map[string]string, ignore []string, precedence []*Precedence, unions ...*UnionDef) *StructParser[T] {
+	b := &structBuilder{
+		unions: make(map[reflect.Type]*UnionDef),
+		names:  make(map[reflect.Type]string),
+		types:  make(map[string]reflect.Type),
+		rules:  make([]*SyntaxRule[any], 0),
+		queue:  make([]reflect.Type, 0),
+	}
+	for _, u := range unions {
+		b.unions[u.iface] = u
+	}
+
+	root := reflect.TypeOf((*T)(nil)).Elem()
+	b.nonterminal(root)
+	for len(b.queue) > 0 {
+		t := b.queue[0]
+		b.queue = b.queue[1:]
+		if t.Kind() == reflect.Interface {
+			b.unionRule(t)
+		} else {
+			b.structRule(t)
+		}
+	}
+
+	return &StructParser[T]{
+		parser: CreateParser(lrules, ignore, b.rules, precedence),
+		rules:  b.rules,
+	}
+}
+
+func (p *StructParser[T]) Parse(s string) (T, error) {
+	t, tokenErr := p.parser.Tokenize(s)
+	if tokenErr != nil {
+		var zero T
+		return zero, tokenErr
+	}
+	return p.ParseToken(t)
+}
+
+func (p *StructParser[T]) ParseToken(tokens []*Token) (T, error) {
+	var zero T
+	result, err := p.parser.ParseToken(tokens)
+	if err != nil {
+		return zero, err
+	}
+	if result == nil {
+		return zero, nil
+	}
+	return result.(T), nil
+}
+
+// the rules generated from the structs
+func (p *StructParser[T]) Rules() []*SyntaxRule[any] {
+	return p.rules
+}
+
+const (
+	captureToken = iota
+	captureNode
+	captureList
+	captureOption
+	capturePass
+)
+
+// How the value of a symbol is converted into a field
+type structCapture struct {
+	kind  int
+	inner *structCapture
+}
+
+type structField struct {
+	index   int
+	pos     int // position of the captured symbol in the production
+	capture *structCapture
+}
+
+type structBuilder struct {
+	unions map[reflect.Type]*UnionDef
+	names  map[reflect.Type]string // nonterminal of each type
+	types  map[string]reflect.Type
+	rules  []*SyntaxRule[any]
+	queue  []reflect.Type
+}
+
+var structRepeat = regexp.MustCompile(`(@@|@\w+)([*+?])`)
+
+// Get the nonterminal of a pointer to struct or a union interface, and queue
+// its rule if it is new.
+func (b *structBuilder) nonterminal(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+
+	var name string
+	if t.Kind() == reflect.Interface {
+		if _, ok := b.unions[t]; !ok {
+			panic(fmt.Sprintf("interface %s is not declared by Union", t))
+		}
+		name = t.Name()
+	} else if t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct {
+		name = t.Elem().Name()
+	} else {
+		panic(fmt.Sprintf("type %s is neither a pointer to struct nor a union", t))
+	}
+
+	if other, ok := b.types[name]; ok {
+		panic(fmt.Sprintf("types %s and %s have the same name", t, other))
+	}
+	b.names[t] = name
+	b.types[name] = t
+	b.queue = append(b.queue, t)
+	return name
+}
+
+func (b *structBuilder) unionRule(t reflect.Type) {
+	u := b.unions[t]
+	rule := &SyntaxRule[any]{
+		Name:   b.names[t],
+		Expand: make([]*RuleOps[any], 0),
+	}
+	for _, m := range u.members {
+		if !m.Implements(t) {
+			panic(fmt.Sprintf("%s in the union does not implement %s", m, t))
+		}
+		rule.Expand = append(rule.Expand, &RuleOps[any]{
+			Ops: b.nonterminal(m),
+			RFunc: func(vals []Value[any]) (any, error) {
+				return vals[0].Val, nil
+			},
+		})
+	}
+	b.rules = append(b.rules, rule)
+}
+
+func (b *structBuilder) structRule(t reflect.Type) {
+	st := t.Elem()
+	ops := ""
+	pos := 0
+	fields := make([]*structField, 0)
+
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		tag, ok := f.Tag.Lookup("goblin")
+		if !ok {
+			tag = string(f.Tag)
+		}
+		if tag == "" {
+			continue
+		}
+		if !f.IsExported() {
+			panic(fmt.Sprintf("field %s of %s has a tag but is not exported", f.Name, st.Name()))
+		}
+
+		tag = structRepeat.ReplaceAllStringFunc(tag, func(s string) string {
+			switch s[len(s)-1] {
+			case '*':
+				return fmt.Sprintf("list(%s)", s[:len(s)-1])
+			case '+':
+				return fmt.Sprintf("nonempty_list(%s)", s[:len(s)-1])
+			default:
+				return fmt.Sprintf("option(%s)", s[:len(s)-1])
+			}
+		})
+
+		var field *structField
+		for _, sym := range expStr2Arr(tag) {
+			resolved, capture := b.resolve(sym, f.Type, st.Name())
+			if capture != nil {
+				if field != nil {
+					panic(fmt.Sprintf("field %s of %s captures more than once", f.Name, st.Name()))
+				}
+				field = &structField{
+					index:   i,
+					pos:     pos,
+					capture: capture,
+				}
+				fields = append(fields, field)
+			}
+			ops += resolved + " "
+			pos++
+		}
+		if field == nil {
+			panic(fmt.Sprintf("field %s of %s captures nothing", f.Name, st.Name()))
+		}
+	}
+
+	rule := &SyntaxRule[any]{
+		Name: b.names[t],
+		Expand: []*RuleOps[any]{
+			{
+				Ops: ops,
+				RFunc: func(vals []Value[any]) (any, error) {
+					node := reflect.New(st)
+					for _, field := range fields {
+						fv := node.Elem().Field(field.index)
+						v, err := convertCapture(vals[field.pos], field.capture, fv.Type())
+						if err != nil {
+							return nil, fmt.Errorf("%s.%s: %v", st.Name(), st.Field(field.index).Name, err)
+						}
+						fv.Set(v)
+					}
+					return node.Interface(), nil
+				},
+			},
+		},
+	}
+	b.rules = append(b.rules, rule)
+}
+
+// Turn a symbol of a tag into the symbol of the production. The capture tells
+// how to fill a field of type t, it is nil if the symbol captures nothing.
+func (b *structBuilder) resolve(sym string, t reflect.Type, owner string) (string, *structCapture) {
+	if sym == "@@" {
+		return b.nonterminal(t), &structCapture{kind: captureNode}
+	}
+	if sym[0] == '@' {
+		switch t.Kind() {
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		default:
+			if t != reflect.TypeOf(&Token{}) {
+				panic(fmt.Sprintf("can not capture token %s of %s into %s", sym[1:], owner, t))
+			}
+		}
+		return sym[1:], &structCapture{kind: captureToken}
+	}
+	if !isTemplateCall(sym) {
+		return sym, nil
+	}
+
+	name, args := splitTemplateCall(sym)
+	var capture *structCapture
+	for i, arg := range args {
+		var elem reflect.Type
+		kind := capturePass
+		switch name {
+		case "list", "nonempty_list", "separated_list", "separated_nonempty_list":
+			if t.Kind() != reflect.Slice {
+				panic(fmt.Sprintf("%s of %s needs a slice, got %s", name, owner, t))
+			}
+			elem = t.Elem()
+			kind = captureList
+		case "option":
+			elem = t
+			kind = captureOption
+		case "delimited", "preceded", "terminated":
+			elem = t
+		default:
+			elem = nil
+		}
+
+		if elem == nil {
+			args[i] = arg
+			if arg[0] == '@' || isTemplateCall(arg) {
+				panic(fmt.Sprintf("can not capture through template %s of %s", name, owner))
+			}
+			continue
+		}
+
+		resolved, inner := b.resolve(arg, elem, owner)
+		args[i] = resolved
+		if inner != nil {
+			if capture != nil {
+				panic(fmt.Sprintf("%s of %s captures more than once", sym, owner))
+			}
+			capture = &structCapture{kind: kind, inner: inner}
+		}
+	}
+
+	return joinTemplateCall(name, args), capture
+}
+
+func convertCapture(v Value[any], c *structCapture, t reflect.Type) (reflect.Value, error) {
+	switch c.kind {
+	case captureToken:
+		return convertToken(v.Token, t)
+	case captureNode:
+		if v.Val == nil {
+			return reflect.Zero(t), nil
+		}
+		val := reflect.ValueOf(v.Val)
+		if !val.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("can not assign %s to %s", val.Type(), t)
+		}
+		return val, nil
+	case captureList:
+		list := reflect.MakeSlice(t, 0, len(v.Items))
+		for _, item := range v.Items {
+			iv, err := convertCapture(item, c.inner, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			list = reflect.Append(list, iv)
+		}
+		return list, nil
+	case captureOption:
+		if len(v.Items) == 0 {
+			return reflect.Zero(t), nil
+		}
+		return convertCapture(v.Items[0], c.inner, t)
+	}
+	return convertCapture(v, c.inner, t)
+}
+
+func convertToken(token *Token, t reflect.Type) (reflect.Value, error) {
+	if t == reflect.TypeOf(token) {
+		return reflect.ValueOf(token), nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(token.Value)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int64:
+		num, err := strconv.ParseInt(token.Value, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(num)
+	case reflect.Float64:
+		num, err := strconv.ParseFloat(token.Value, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetFloat(num)
+	}
+	return v, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+type stProgram struct {
+	Stmts []*stAssign `goblin:"@@*"`
+}
+
+type stAssign struct {
+	Name  string `goblin:"@NAME"`
+	Value stExpr `goblin:"ASSIGN @@ SEMI"`
+}
+
+type stExpr interface {
+	expr()
+}
+
+type stSum struct {
+	Lhs stExpr `goblin:"@@"`
+	Op  *Token `goblin:"@PLUS"`
+	Rhs stExpr `goblin:"@@"`
+}
+
+type stProduct struct {
+	Lhs stExpr `goblin:"@@"`
+	Rhs stExpr `goblin:"MULTIPLY @@"`
+}
+
+type stNumber struct {
+	Negative bool `goblin:"@MINUS?"`
+	Value    int  `goblin:"@NUMBER"`
+}
+
+type stCall struct {
+	Fn   string   `goblin:"@NAME"`
+	Args []stExpr `goblin:"LPAREN separated_list(COMMA, @@) RPAREN"`
+}
+
+type stParen struct {
+	Inner stExpr `goblin:"delimited(LPAREN, @@, RPAREN)"`
+}
+
+func (*stSum) expr()     {}
+func (*stProduct) expr() {}
+func (*stNumber) expr()  {}
+func (*stCall) expr()    {}
+func (*stParen) expr()   {}
+
+func (n *stNumber) eval() int {
+	if n.Negative {
+		return -n.Value
+	}
+	return n.Value
+}
+
+func stEval(e stExpr) int {
+	switch n := e.(type) {
+	case *stSum:
+		return stEval(n.Lhs) + stEval(n.Rhs)
+	case *stProduct:
+		return stEval(n.Lhs) * stEval(n.Rhs)
+	case *stNumber:
+		return n.eval()
+	case *stParen:
+		return stEval(n.Inner)
+	case *stCall:
+		sum := 0
+		for _, arg := range n.Args {
+			sum += stEval(arg)
+		}
+		return sum
+	}
+	return 0
+}
+
+func createStructParser() *StructParser[*stProgram] {
+	symbols := map[string]string{
+		"NAME":     "[a-zA-Z_][a-zA-Z0-9_]*",
+		"NUMBER":   "[0-9]+",
+		"PLUS":     "\\+",
+		"MINUS":    "\\-",
+		"MULTIPLY": "\\*",
+		"ASSIGN":   "=",
+		"SEMI":     ";",
+		"COMMA":    ",",
+		"LPAREN":   "\\(",
+		"RPAREN":   "\\)",
+	}
+	precedences := []*Precedence{
+		{
+			TokenType: []string{"PLUS"},
+			Level:     1,
+		},
+		{
+			TokenType: []string{"MULTIPLY"},
+			Level:     2,
+		},
+	}
+
+	return CreateStructParser[*stProgram](symbols, []string{" ", "\t"}, precedences,
+		Union[stExpr](&stSum{}, &stProduct{}, &stNumber{}, &stCall{}, &stParen{}))
+}
+
+func TestStructGrammar(t *testing.T) {
+	p := createStructParser()
+	for _, rule := range p.Rules() {
+		for _, ops := range rule.Expand {
+			fmt.Printf("%s -> %s\n", rule.Name, ops.Ops)
+		}
+	}
+
+	program, err := p.Parse("a = 1 + 2 * 3; b = sum(1, -2, (3 + 4)) * 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Stmts) != 2 {
+		t.Fatalf("Expected 2 statements, got %d", len(program.Stmts))
+	}
+
+	first := program.Stmts[0]
+	if first.Name != "a" || stEval(first.Value) != 7 {
+		t.Errorf("Unexpected %s = %d", first.Name, stEval(first.Value))
+	}
+	if sum, ok := first.Value.(*stSum); !ok || sum.Op.Value != "+" {
+		t.Errorf("Expected a sum at the top of a")
+	}
+
+	second := program.Stmts[1]
+	if second.Name != "b" || stEval(second.Value) != 12 {
+		t.Errorf("Unexpected %s = %d", second.Name, stEval(second.Value))
+	}
+}
+
+func TestStructGrammarErrors(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for interface not declared by Union")
+		}
+	}()
+
+	CreateStructParser[*stProgram](map[string]string{"NAME": "[a-z]+"}, []string{" "}, []*Precedence{})
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// An action of the parse tables: 0 is an error, a positive action shifts to
+// the state action-1, and a negative one reduces the production -action-1.
+// Reducing the start production S' accepts.
+const (
+	errorAction  = 0
+	acceptAction = -1
+)
+
+func shiftAction(state int) int32 {
+	return int32(state + 1)
+}
+
+func reduceAction(prod int) int32 {
+	return int32(-prod - 1)
+}
+
+// The compressed integer tables of the LR driver, encoded from the action and
+// the goto tables of the lrTable. The terminals and the nonterminals are
+// numbered at build time, so that the driver looks up the number of each
+// token once and then only indexes slices.
+type parseTables struct {
+	terminals    map[string]int // terminal: column of the action table
+	nonterminals map[string]int // nonterminal: row of the goto table
+	// the actions by state and terminal, whose default is the most common
+	// reduction of the state, so that its errors are found after reducing
+	action *combVector
+	// the next states by nonterminal and state, whose default is the most
+	// common next state of the nonterminal
+	gotos *combVector
+	// the nonterminal and the number of symbols of each production
+	lhs    []int32
+	rhsLen []int32
+	// number of the entries of the tables before the compression
+	denseEntries int
+}
+
+// Number the symbols, $end first and then the terminals in order, and the
+// nonterminals in the order of the productions, and encode the tables.
+func (self *lrTable) encode() *parseTables {
+	g := self.grammar
+	t := &parseTables{
+		terminals:    map[string]int{ENDTOKEN: 0},
+		nonterminals: make(map[string]int),
+		lhs:          make([]int32, len(g.productions)),
+		rhsLen:       make([]int32, len(g.productions)),
+	}
+
+	terms := make([]string, 0, len(g.terminals))
+	for term := range g.terminals {
+		if term != ENDTOKEN {
+			terms = append(terms, term)
+		}
+	}
+	sort.Strings(terms)
+	for _, term := range terms {
+		t.terminals[term] = len(t.terminals)
+	}
+	for i, prod := range g.productions {
+		if _, ok := t.nonterminals[prod.name]; !ok {
+			t.nonterminals[prod.name] = len(t.nonterminals)
+		}
+		t.lhs[i] = int32(t.nonterminals[prod.name])
+		t.rhsLen[i] = int32(prod.prodSize)
+	}
+
+	nStates := len(self.closures)
+	actions := make([][]int32, nStates)
+	for state := range actions {
+		row := make([]int32, len(t.terminals))
+		for term, action := range self.lrAction[state] {
+			switch action[0] {
+			case 's':
+				row[t.terminals[term]] = shiftAction(turnAction2id(action))
+			case 'r':
+				row[t.terminals[term]] = reduceAction(turnAction2id(action))
+			default:
+				row[t.terminals[term]] = acceptAction
+			}
+		}
+		actions[state] = row
+	}
+
+	gotos := make([][]int32, len(t.nonterminals))
+	for i := range gotos {
+		gotos[i] = make([]int32, nStates)
+		for state := range gotos[i] {
+			gotos[i][state] = -1
+		}
+	}
+	for state := range self.closures {
+		for nonterm, next := range self.lrGoto[state] {
+			gotos[t.nonterminals[nonterm]][state] = int32(next)
+		}
+	}
+
+	// a reduction is the default of a state, a shift never is since it
+	// would consume a wrong token
+	actionDefaults := make([]int32, nStates)
+	for state, row := range actions {
+		actionDefaults[state] = mostCommon(row, func(a int32) bool {
+			return a < acceptAction
+		}, errorAction)
+	}
+	// a missing goto can not be reached, so any next state is its default
+	gotoDefaults := make([]int32, len(gotos))
+	for i, row := range gotos {
+		gotoDefaults[i] = mostCommon(row, func(next int32) bool {
+			return next >= 0
+		}, -1)
+	}
+
+	t.action = packRows(actions, actionDefaults, errorAction)
+	t.gotos = packRows(gotos, gotoDefaults, -1)
+	t.denseEntries = nStates * (len(t.terminals) + len(t.nonterminals))
+	return t
+}
+
+// the value of the row kept by keep which is the most common, the smallest
+// one among the ties, or none if no value is kept
+func mostCommon(row []int32, keep func(int32) bool, none int32) int32 {
+	counts := make(map[int32]int)
+	result, best := none, 0
+	for _, v := range row {
+		if !keep(v) {
+			continue
+		}
+		counts[v]++
+		if counts[v] > best || (counts[v] == best && v < result) {
+			result, best = v, counts[v]
+		}
+	}
+	return result
+}
+
+// the action of state on the terminal numbered term, which is -1 for a token
+// which is not a terminal of the grammar
+func (t *parseTables) actionOf(state int, term int) int32 {
+	if term < 0 {
+		return errorAction
+	}
+	return t.action.get(state, term)
+}
+
+// the next state after reducing the production prod in state, -1 if none
+func (t *parseTables) gotoOf(state int, prod int) int {
+	return int(t.gotos.get(int(t.lhs[prod]), state))
+}
+
+// the numbers of the types of the tokens
+func (t *parseTables) tokenTerminals(tokens []*Token) []int {
+	terms := make([]int, len(tokens))
+	for i, token := range tokens {
+		term, ok := t.terminals[token.Type]
+		if !ok {
+			term = -1
+		}
+		terms[i] = term
+	}
+	return terms
+}
+
+// A table compressed by row displacement: the entries of each row which are
+// not its default are laid in one vector from the base of the row, and the
+// rows are displaced so that their entries fill the holes of each other. The
+// check vector tells the row owning each entry.
+type combVector struct {
+	defaults []int32
+	base     []int32
+	next     []int32
+	check    []int32
+}
+
+func (c *combVector) get(row int, col int) int32 {
+	i := int(c.base[row]) + col
+	if i < len(c.check) && int(c.check[i]) == row {
+		return c.next[i]
+	}
+	return c.defaults[row]
+}
+
+// the number of the entries of the vectors
+func (c *combVector) entries() int {
+	return len(c.defaults) + len(c.base) + len(c.next) + len(c.check)
+}
+
+// Pack the rows, leaving out their defaults and the entries equal to
+// dontCare. The rows with the most entries are laid first, each at the
+// first base where it fits.
+func packRows(rows [][]int32, defaults []int32, dontCare int32) *combVector {
+	c := &combVector{
+		defaults: defaults,
+		base:     make([]int32, len(rows)),
+		next:     make([]int32, 0),
+		check:    make([]int32, 0),
+	}
+
+	cols := make([][]int, len(rows))
+	for i, row := range rows {
+		for col, v := range row {
+			if v != defaults[i] && v != dontCare {
+				cols[i] = append(cols[i], col)
+			}
+		}
+	}
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(cols[order[a]]) > len(cols[order[b]])
+	})
+
+	for _, i := range order {
+		if len(cols[i]) == 0 {
+			continue
+		}
+		base := 0
+		for !fits(c.check, base, cols[i]) {
+			base++
+		}
+		for _, col := range cols[i] {
+			for base+col >= len(c.check) {
+				c.next = append(c.next, 0)
+				c.check = append(c.check, -1)
+			}
+			c.next[base+col] = rows[i][col]
+			c.check[base+col] = int32(i)
+		}
+		c.base[i] = int32(base)
+	}
+	return c
+}
+
+func fits(check []int32, base int, cols []int) bool {
+	for _, col := range cols {
+		if base+col < len(check) && check[base+col] >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// The sizes of the tables before and after the compression, for WriteMDInfo
+func (p *Parser[T]) tableSizeMD() string {
+	t := p.table.tables
+	nStates := len(t.action.defaults)
+	row := func(name string, dense int, c *combVector) string {
+		return fmt.Sprintf("| %s | %d | %d | %d | %d |\n",
+			name, dense, dense*4, c.entries(), c.entries()*4)
+	}
+
+	result := "# Table Size\n"
+	result += "\n"
+	result += "| Table | Dense Entries | Dense Bytes | Compressed Entries | Compressed Bytes |\n"
+	result += "| --- | --- | --- | --- | --- |\n"
+	result += row("Action", nStates*len(t.terminals), t.action)
+	result += row("Goto", nStates*len(t.nonterminals), t.gotos)
+	compressed := t.action.entries() + t.gotos.entries()
+	result += fmt.Sprintf("| Total | %d | %d | %d | %d |\n",
+		t.denseEntries, t.denseEntries*4, compressed, compressed*4)
+	result += "\n"
+	return result
+}
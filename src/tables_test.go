@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func calcBenchInput() string {
+	return strings.Repeat("(1 + 2) * -3 - 4 / (5 - 6) + ", 200) + "7"
+}
+
+// the compressed tables agree with the action and the goto tables, where an
+// error may be the default reduction and a missing goto any next state
+func TestParseTables(t *testing.T) {
+	table := createCalc().parser.table
+	tables := table.tables
+	if tables.terminals[ENDTOKEN] != 0 || tables.nonterminals["S'"] != 0 {
+		t.Errorf("Expected $end and S' numbered first")
+	}
+
+	for state := range table.closures {
+		for term, column := range tables.terminals {
+			action := tables.actionOf(state, column)
+			want, ok := table.lrAction[state][term]
+			switch {
+			case !ok:
+				if action != errorAction && action != tables.action.defaults[state] {
+					t.Errorf("Expected no action in state %d on %s, got %d", state, term, action)
+				}
+			case want == "accepted":
+				if action != acceptAction {
+					t.Errorf("Expected accept in state %d, got %d", state, action)
+				}
+			case want[0] == 's':
+				if action != shiftAction(turnAction2id(want)) {
+					t.Errorf("Expected %s in state %d on %s, got %d", want, state, term, action)
+				}
+			default:
+				if action != reduceAction(turnAction2id(want)) {
+					t.Errorf("Expected %s in state %d on %s, got %d", want, state, term, action)
+				}
+			}
+		}
+		for i, prod := range table.grammar.productions {
+			want, ok := table.lrGoto[state][prod.name]
+			if next := tables.gotoOf(state, i); ok && next != want {
+				t.Errorf("Expected goto %d in state %d on %s, got %d", want, state, prod.name, next)
+			}
+		}
+	}
+	if tables.actionOf(0, -1) != errorAction {
+		t.Errorf("Expected an error for an unknown token")
+	}
+	if tables.action.entries()+tables.gotos.entries() >= tables.denseEntries {
+		t.Errorf("Expected fewer entries than the %d of the dense tables", tables.denseEntries)
+	}
+}
+
+func TestTableSizeMD(t *testing.T) {
+	p := CreateParser(cSymbols, []string{" ", "\n"}, createCRules(), []*Precedence{}, Expect{ShiftReduce: 1})
+	md := p.tableSizeMD()
+	t.Log(md)
+	if !strings.Contains(md, "| Action | 29050 | 116200 |") {
+		t.Errorf("Expected the dense action table of 350 states and 83 terminals")
+	}
+}
+
+func TestCombVector(t *testing.T) {
+	rows := [][]int32{
+		{0, 5, 0, 0, 6},
+		{7, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{-3, -3, 8, -3, 0},
+	}
+	defaults := []int32{0, 0, 0, -3}
+	c := packRows(rows, defaults, 0)
+	for i, row := range rows {
+		for col, v := range row {
+			want := v
+			if v == 0 {
+				want = defaults[i]
+			}
+			if got := c.get(i, col); got != want {
+				t.Errorf("Expected %d at %d, %d, got %d", want, i, col, got)
+			}
+		}
+	}
+	// the rows fill the holes of each other
+	if len(c.next) != 5 {
+		t.Errorf("Expected 5 packed entries, got %d", len(c.next))
+	}
+}
+
+func BenchmarkParseCalc(b *testing.B) {
+	p := createCalc().parser
+	tokens, err := p.Tokenize(calcBenchInput())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ParseToken(tokens); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
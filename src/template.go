@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A template is a SyntaxRule with Params, e.g.
+//
+//	separated_list(SEP, X) -> | separated_nonempty_list(SEP, X)
+//
+// It is not a nonterminal by itself. Every use like separated_list(COMMA, expr)
+// in an Ops string creates a concrete nonterminal named after the call, whose
+// productions are the Expand of the template with the parameters substituted.
+// The expansion happens in setRules, before any LR item is built.
+
+// nested instantiation deeper than this is considered as non-terminating
+const maxTemplateDepth = 16
+
+// the templates shipped with goblin. Their values are Value.Items for the
+// options, the lists and the pairs, and the value of X for the others. Rules
+// of the user with the same name override them.
+func stdTemplates[T any]() []*SyntaxRule[T] {
+	first := func(vals []Value[T]) (Value[T], error) {
+		return vals[0], nil
+	}
+	second := func(vals []Value[T]) (Value[T], error) {
+		return vals[1], nil
+	}
+	emptyList := func(vals []Value[T]) (Value[T], error) {
+		return Value[T]{Items: []Value[T]{}}, nil
+	}
+	singleList := func(vals []Value[T]) (Value[T], error) {
+		return Value[T]{Items: []Value[T]{vals[0]}}, nil
+	}
+	// append the last value to a copy of the list in front, which may be the
+	// value of a node shared by two parents of a forest
+	appendList := func(vals []Value[T]) (Value[T], error) {
+		l := vals[0]
+		items := make([]Value[T], len(l.Items), len(l.Items)+1)
+		copy(items, l.Items)
+		l.Items = append(items, vals[len(vals)-1])
+		return l, nil
+	}
+	pair := func(i int, j int) func(vals []Value[T]) (Value[T], error) {
+		return func(vals []Value[T]) (Value[T], error) {
+			return Value[T]{Items: []Value[T]{vals[i], vals[j]}}, nil
+		}
+	}
+
+	return []*SyntaxRule[T]{
+		{
+			Name:   "option",
+			Params: []string{"X"},
+			Expand: []*RuleOps[T]{
+				{Ops: "", vFunc: emptyList},
+				{Ops: "X", vFunc: singleList},
+			},
+		},
+		{
+			Name:   "list",
+			Params: []string{"X"},
+			Expand: []*RuleOps[T]{
+				{Ops: "", vFunc: emptyList},
+				{Ops: "list(X) X", vFunc: appendList},
+			},
+		},
+		{
+			Name:   "nonempty_list",
+			Params: []string{"X"},
+			Expand: []*RuleOps[T]{
+				{Ops: "X", vFunc: singleList},
+				{Ops: "nonempty_list(X) X", vFunc: appendList},
+			},
+		},
+		{
+			Name:   "separated_list",
+			Params: []string{"SEP", "X"},
+			Expand: []*RuleOps[T]{
+				{Ops: "", vFunc: emptyList},
+				{Ops: "separated_nonempty_list(SEP, X)", vFunc: first},
+			},
+		},
+		{
+			Name:   "separated_nonempty_list",
+			Params: []string{"SEP", "X"},
+			Expand: []*RuleOps[T]{
+				{Ops: "X", vFunc: singleList},
+				{Ops: "separated_nonempty_list(SEP, X) SEP X", vFunc: appendList},
+			},
+		},
+		{
+			Name:   "delimited",
+			Params: []string{"L", "X", "R"},
+			Expand: []*RuleOps[T]{
+				{Ops: "L X R", vFunc: second},
+			},
+		},
+		{
+			Name:   "preceded",
+			Params: []string{"L", "X"},
+			Expand: []*RuleOps[T]{
+				{Ops: "L X", vFunc: second},
+			},
+		},
+		{
+			Name:   "terminated",
+			Params: []string{"X", "R"},
+			Expand: []*RuleOps[T]{
+				{Ops: "X R", vFunc: first},
+			},
+		},
+		{
+			Name:   "pair",
+			Params: []string{"X", "Y"},
+			Expand: []*RuleOps[T]{
+				{Ops: "X Y", vFunc: pair(0, 1)},
+			},
+		},
+		{
+			Name:   "separated_pair",
+			Params: []string{"X", "SEP", "Y"},
+			Expand: []*RuleOps[T]{
+				{Ops: "X SEP Y", vFunc: pair(0, 2)},
+			},
+		},
+	}
+}
+
+// The templates available to a grammar and their instances.
+type templateSet[T any] struct {
+	g         *grammar
+	templates map[string]*SyntaxRule[T]
+	instances *StrSet // template calls already instantiated
+	queue     []string
+}
+
+// Register the standard templates and the templates defined by the user. A
+// nonterminal of the user hides the standard template with the same name.
+func createTemplateSet[T any](g *grammar, rules []*SyntaxRule[T]) *templateSet[T] {
+	ts := &templateSet[T]{
+		g:         g,
+		templates: make(map[string]*SyntaxRule[T]),
+		instances: createSet(),
+		queue:     make([]string, 0),
+	}
+
+	defined := createSet()
+	for _, rule := range rules {
+		if len(rule.Params) == 0 {
+			defined.add(rule.Name)
+		}
+	}
+	for _, t := range stdTemplates[T]() {
+		if !defined.contains(t.Name) {
+			ts.templates[t.Name] = t
+		}
+	}
+
+	for _, rule := range rules {
+		if len(rule.Params) == 0 {
+			continue
+		}
+		if defined.contains(rule.Name) {
+			panic(fmt.Sprintf("duplicate template %s", rule.Name))
+		}
+		defined.add(rule.Name)
+		ts.templates[rule.Name] = rule
+	}
+
+	return ts
+}
+
+func (ts *templateSet[T]) has(name string) bool {
+	_, ok := ts.templates[name]
+	return ok
+}
+
+// Check every template call in ops and queue the instances which are not yet
+// created.
+func (ts *templateSet[T]) use(ops []string) {
+	for _, sym := range ops {
+		if !isTemplateCall(sym) {
+			continue
+		}
+		if ts.instances.contains(sym) {
+			continue
+		}
+
+		name, args := splitTemplateCall(sym)
+		t, ok := ts.templates[name]
+		if !ok {
+			panic(fmt.Sprintf("unknown template %s in %s", name, sym))
+		}
+		if len(t.Params) != len(args) {
+			panic(fmt.Sprintf("template %s expects %d argument(s), got %d in %s", name, len(t.Params), len(args), sym))
+		}
+		if strings.Count(sym, "(") > maxTemplateDepth {
+			panic(fmt.Sprintf("template expansion of %s does not terminate", name))
+		}
+
+		// arguments may be template calls as well
+		ts.use(args)
+
+		ts.instances.add(sym)
+		ts.queue = append(ts.queue, sym)
+	}
+}
+
+// Turn all the queued template calls into concrete productions. Instantiation
+// can queue more calls, so loop until nothing is left.
+func (ts *templateSet[T]) instantiate() {
+	for len(ts.queue) > 0 {
+		sym := ts.queue[0]
+		ts.queue = ts.queue[1:]
+
+		name, args := splitTemplateCall(sym)
+		t := ts.templates[name]
+		bindings := make(map[string]string)
+		for i, param := range t.Params {
+			bindings[param] = args[i]
+		}
+
+		for _, ops := range t.Expand {
+			rOps, labels := splitLabels(t.Name, expStr2Arr(ops.Ops))
+			for i, item := range rOps {
+				rOps[i] = substTemplateParams(item, bindings)
+			}
+			ts.use(rOps)
+			mids := bindMidActions(t.Name, ops, rOps, labels)
+			action := bindAction(t.Name, ops, labels)
+			ts.g.addProduction(sym, rOps, action, mids).labels = labels
+		}
+	}
+}
+
+// replace the parameters in sym, including those in the arguments of a call
+func substTemplateParams(sym string, bindings map[string]string) string {
+	if isTemplateCall(sym) {
+		name, args := splitTemplateCall(sym)
+		for i, arg := range args {
+			args[i] = substTemplateParams(arg, bindings)
+		}
+		return joinTemplateCall(name, args)
+	}
+
+	if bound, ok := bindings[sym]; ok {
+		return bound
+	}
+	return sym
+}
+
+func isTemplateCall(sym string) bool {
+	return strings.HasSuffix(sym, ")")
+}
+
+func joinTemplateCall(name string, args []string) string {
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ","))
+}
+
+// split the canonical form name(a,b(c,d)) into name and the top level arguments
+func splitTemplateCall(sym string) (string, []string) {
+	open := strings.Index(sym, "(")
+	name := sym[:open]
+	body := sym[open+1 : len(sym)-1]
+
+	args := make([]string, 0)
+	depth := 0
+	start := 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, body[start:])
+
+	return name, args
+}
+
+// Scan the call starting at s[open] == '(' and return its canonical form
+// together with the index after the closing parenthesis.
+func scanTemplateCall(name string, s string, open int) (string, int) {
+	depth := 0
+	start := open + 1
+	args := make([]string, 0)
+
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				args = append(args, scanTemplateArg(name, s[start:i]))
+				return joinTemplateCall(name, args), i + 1
+			}
+		case ',':
+			if depth == 1 {
+				args = append(args, scanTemplateArg(name, s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	panic(fmt.Sprintf("unbalanced parenthesis in the call of template %s", name))
+}
+
+func scanTemplateArg(name string, arg string) string {
+	syms := expStr2Arr(arg)
+	if len(syms) != 1 || strings.Contains(syms[0], "=") || isMidAction(syms[0]) {
+		panic(fmt.Sprintf("invalid argument \"%s\" in the call of template %s", strings.TrimSpace(arg), name))
+	}
+	return syms[0]
+}
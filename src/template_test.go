@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestTemplateOps(t *testing.T) {
+	ops := expStr2Arr("NAME delimited( LPAREN, separated_list(COMMA, expr),RPAREN ) %prec UMINUS")
+	expected := []string{"NAME", "delimited(LPAREN,separated_list(COMMA,expr),RPAREN)", "%prec", "UMINUS"}
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, ops)
+	}
+	for i := range ops {
+		if ops[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], ops[i])
+		}
+	}
+
+	name, args := splitTemplateCall(ops[1])
+	if name != "delimited" || len(args) != 3 || args[1] != "separated_list(COMMA,expr)" {
+		t.Errorf("Unexpected split %s %v", name, args)
+	}
+}
+
+func createSumParser() *Parser[int] {
+	symbols := map[string]string{
+		"NAME":   "[a-zA-Z_][a-zA-Z0-9_]*",
+		"NUMBER": "[0-9]+",
+		"COMMA":  ",",
+		"LPAREN": "\\(",
+		"RPAREN": "\\)",
+		"LBRACE": "\\{",
+		"RBRACE": "\\}",
+	}
+
+	ignores := []string{
+		"\t", " ",
+	}
+
+	rules := []*SyntaxRule[int]{
+		{
+			Name: "call",
+			Expand: []*RuleOps[int]{
+				{
+					Ops: "NAME delimited(LPAREN, separated_list(COMMA, expr), RPAREN) option(braced(expr))",
+					RFunc: func(vals []Value[int]) (int, error) {
+						sum := 0
+						for _, item := range vals[1].Items {
+							sum += item.Val
+						}
+						// multiply by the optional factor
+						for _, factor := range vals[2].Items {
+							sum *= factor.Val
+						}
+						return sum, nil
+					},
+				},
+			},
+		},
+		{
+			Name:   "braced",
+			Params: []string{"X"},
+			Expand: []*RuleOps[int]{
+				{
+					Ops: "LBRACE X RBRACE",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return vals[1].Val, nil
+					},
+				},
+			},
+		},
+		{
+			Name: "expr",
+			Expand: []*RuleOps[int]{
+				{
+					Ops: "NUMBER",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return strconv.Atoi(vals[0].Token.Value)
+					},
+				},
+			},
+		},
+	}
+
+	return CreateParser(symbols, ignores, rules, []*Precedence{})
+}
+
+func TestStdTemplates(t *testing.T) {
+	p := createSumParser()
+	fmt.Println(p.grammar.string())
+
+	cases := map[string]int{
+		"sum(1, 2, 3)":    6,
+		"sum()":           0,
+		"sum(4)":          4,
+		"sum(1, 2) { 0 }": 0,
+		"sum(1, 2) { 3 }": 9,
+	}
+	for input, expected := range cases {
+		result, err := p.Parse(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("%s: expected %d, got %d", input, expected, result)
+		}
+	}
+
+	if _, err := p.Parse("sum(1, 2,)"); err == nil {
+		t.Errorf("Expected syntax error for trailing comma")
+	}
+}
+
+func TestUnknownTemplate(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for unknown template")
+		}
+	}()
+
+	l := CreateLexer(map[string]string{"NUMBER": "[0-9]+"}, []string{" "})
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "expr",
+			Expand: []*RuleOps[any]{
+				{
+					Ops: "unknown(NUMBER)",
+				},
+			},
+		},
+	}
+	CreateGrammar(l, rules, []*Precedence{})
+}
+
+func TestAppendListCopies(t *testing.T) {
+	var appendList func([]Value[int]) (Value[int], error)
+	for _, rule := range stdTemplates[int]() {
+		if rule.Name == "list" {
+			appendList = rule.Expand[1].vFunc
+		}
+	}
+
+	// the value of a node shared by two parents, with room to append in place
+	shared := Value[int]{Items: make([]Value[int], 1, 4)}
+	a, _ := appendList([]Value[int]{shared, {Val: 1}})
+	b, _ := appendList([]Value[int]{shared, {Val: 2}})
+	if a.Items[1].Val != 1 || b.Items[1].Val != 2 || len(shared.Items) != 1 {
+		t.Errorf("Expected separate lists, got %v and %v", a.Items, b.Items)
+	}
+}
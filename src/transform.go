@@ -0,0 +1,715 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var nonSymbolChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// A rewrite of the rules of a grammar, applied by Parser.Rewrite
+type Transform int
+
+const (
+	// Eliminate the direct and the indirect left recursion by Paull's
+	// algorithm, which needs a grammar without cycle and empty production,
+	// so those of the grammar are removed first.
+	RemoveLeftRecursion Transform = iota
+	// Factor out the longest prefix common to the productions of a
+	// nonterminal, until no two productions begin with the same symbol.
+	LeftFactor
+	// Replace A -> B by the productions of B.
+	RemoveUnitProductions
+	// Replace the productions by their variants without the nullable
+	// nonterminals, and remove the empty productions. If the start symbol
+	// is nullable, it keeps an empty production when it is on no right
+	// side, and a new start symbol keeps the empty string otherwise.
+	RemoveEmptyProductions
+	// Rewrite the productions as A -> B C, A -> a, and S -> <empty> for the
+	// start symbol S only.
+	ChomskyNormalForm
+)
+
+func (t Transform) String() string {
+	switch t {
+	case RemoveLeftRecursion:
+		return "Remove Left Recursion"
+	case LeftFactor:
+		return "Left Factor"
+	case RemoveUnitProductions:
+		return "Remove Unit Productions"
+	case RemoveEmptyProductions:
+		return "Remove Empty Productions"
+	default:
+		return "Chomsky Normal Form"
+	}
+}
+
+// The result of Parser.Rewrite: the rules of the new grammar, without their
+// actions, and the steps of the rewrite.
+type Rewrite struct {
+	Rules []*SyntaxRule[any]
+	Steps []*RewriteStep
+	// the transforms applied, for the sections of the trace
+	transforms []Transform
+}
+
+// A step of a rewrite: the productions of Before are replaced by those of
+// After.
+type RewriteStep struct {
+	Transform Transform
+	Title     string
+	Before    []string
+	After     []string
+	// the position of the transform in the rewrite, which can apply a
+	// transform more than once
+	pass int
+}
+
+// The rules of a grammar as the alternatives of its nonterminals, which are
+// kept in the order they are defined.
+type cfgRules struct {
+	start     string
+	names     []string
+	alts      map[string][][]string
+	terminals map[string]bool
+	steps     []*RewriteStep
+	pass      int // the position of the transform being applied
+}
+
+// The rules of the grammar. The hidden nonterminals of the mid-rule actions
+// derive the empty string, so they are left out.
+func rulesOf(g *grammar) *cfgRules {
+	c := &cfgRules{
+		start:     g.productions[0].prod[0],
+		names:     make([]string, 0),
+		alts:      make(map[string][][]string),
+		terminals: make(map[string]bool),
+	}
+	for t := range g.terminals {
+		c.terminals[t] = true
+	}
+	for _, prod := range g.productions[1:] {
+		if prod.midOf != "" {
+			continue
+		}
+		alt := make([]string, 0, len(prod.prod))
+		for _, sym := range prod.prod {
+			if !strings.HasPrefix(sym, "$@") {
+				alt = append(alt, sym)
+			}
+		}
+		c.addAlt(prod.name, alt)
+	}
+	c.renameInstances()
+	return c
+}
+
+// Rename the instances of the templates, e.g. separated_list(COMMA,expr) to
+// separated_list_COMMA_expr, since a rule of the rewritten grammar with the
+// name of an instance is merged with the instance of the template.
+func (c *cfgRules) renameInstances() {
+	renamed := make(map[string]string)
+	taken := createSet()
+	for _, name := range c.names {
+		if !nonSymbolChars.MatchString(name) {
+			continue
+		}
+		base := strings.Trim(nonSymbolChars.ReplaceAllString(name, "_"), "_")
+		newName := base
+		for i := 2; c.isNonterminal(newName) || c.terminals[newName] || taken.contains(newName); i++ {
+			newName = fmt.Sprintf("%s%d", base, i)
+		}
+		renamed[name] = newName
+		taken.add(newName)
+	}
+	if len(renamed) == 0 {
+		return
+	}
+
+	rename := func(sym string) string {
+		if newName, ok := renamed[sym]; ok {
+			return newName
+		}
+		return sym
+	}
+	alts := make(map[string][][]string)
+	for i, name := range c.names {
+		for _, alt := range c.alts[name] {
+			newAlt := make([]string, len(alt))
+			for j, sym := range alt {
+				newAlt[j] = rename(sym)
+			}
+			alts[rename(name)] = append(alts[rename(name)], newAlt)
+		}
+		c.names[i] = rename(name)
+	}
+	c.alts = alts
+	c.start = rename(c.start)
+}
+
+func (c *cfgRules) isNonterminal(sym string) bool {
+	_, ok := c.alts[sym]
+	return ok
+}
+
+// add the alternative to name, unless it is already there
+func (c *cfgRules) addAlt(name string, alt []string) {
+	if _, ok := c.alts[name]; !ok {
+		c.names = append(c.names, name)
+		c.alts[name] = make([][]string, 0)
+	}
+	for _, other := range c.alts[name] {
+		if strings.Join(other, " ") == strings.Join(alt, " ") && len(other) == len(alt) {
+			return
+		}
+	}
+	c.alts[name] = append(c.alts[name], alt)
+}
+
+// set the alternatives of name, and remove it if there is none
+func (c *cfgRules) setAlts(name string, alts [][]string) {
+	if len(alts) == 0 {
+		delete(c.alts, name)
+		for i, n := range c.names {
+			if n == name {
+				c.names = append(c.names[:i:i], c.names[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	c.alts[name] = make([][]string, 0, len(alts))
+	for _, alt := range alts {
+		c.addAlt(name, alt)
+	}
+}
+
+// a name derived from base which is not a symbol yet
+func (c *cfgRules) newName(base string, suffix string) string {
+	name := base + "_" + suffix
+	for i := 2; c.isNonterminal(name) || c.terminals[name]; i++ {
+		name = fmt.Sprintf("%s_%s%d", base, suffix, i)
+	}
+	return name
+}
+
+func altString(name string, alt []string) string {
+	if len(alt) == 0 {
+		return fmt.Sprintf("%s -> %s", name, EMPTYTOKEN)
+	}
+	return fmt.Sprintf("%s -> %s", name, strings.Join(alt, " "))
+}
+
+func (c *cfgRules) productions(names ...string) []string {
+	result := make([]string, 0)
+	for _, name := range names {
+		for _, alt := range c.alts[name] {
+			result = append(result, altString(name, alt))
+		}
+	}
+	return result
+}
+
+// Record the step which replaced the productions before by the productions
+// of names
+func (c *cfgRules) step(transform Transform, title string, before []string, names ...string) {
+	c.steps = append(c.steps, &RewriteStep{
+		Transform: transform,
+		Title:     title,
+		Before:    before,
+		After:     c.productions(names...),
+		pass:      c.pass,
+	})
+}
+
+// place the new nonterminal name right after the nonterminal after
+func (c *cfgRules) insertAfter(after string, name string) {
+	for i, n := range c.names {
+		if n == name {
+			c.names = append(c.names[:i:i], c.names[i+1:]...)
+			break
+		}
+	}
+	for i, n := range c.names {
+		if n == after {
+			c.names = append(c.names[:i+1:i+1], append([]string{name}, c.names[i+1:]...)...)
+			return
+		}
+	}
+	c.names = append(c.names, name)
+}
+
+func concat(a []string, b []string) []string {
+	return append(append(make([]string, 0, len(a)+len(b)), a...), b...)
+}
+
+// whether a derives a sentential form beginning with b
+func (c *cfgRules) leftDerives(a string, b string) bool {
+	seen := map[string]bool{a: true}
+	queue := []string{a}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, alt := range c.alts[n] {
+			if len(alt) == 0 || !c.isNonterminal(alt[0]) {
+				continue
+			}
+			if alt[0] == b {
+				return true
+			}
+			if !seen[alt[0]] {
+				seen[alt[0]] = true
+				queue = append(queue, alt[0])
+			}
+		}
+	}
+	return false
+}
+
+// Paull's algorithm: in the order of the nonterminals, substitute the
+// productions of each former nonterminal Aj which begins a production of Ai,
+// and then eliminate the direct left recursion of Ai. Aj is only substituted
+// if it derives Ai on the left, since otherwise it makes no left recursion.
+func (c *cfgRules) removeLeftRecursion() {
+	if c.hasEmptyOrCycle() {
+		c.step(RemoveLeftRecursion, "Remove the empty productions and the cycles, which the algorithm does not handle", nil)
+		first := len(c.steps)
+		c.removeEmptyProductions()
+		c.removeUnitProductions()
+		for _, step := range c.steps[first:] {
+			step.Transform = RemoveLeftRecursion
+		}
+	}
+
+	order := append([]string{}, c.names...)
+	for i, ai := range order {
+		for _, aj := range order[:i] {
+			if !c.isNonterminal(ai) || !c.leftDerives(aj, ai) {
+				continue
+			}
+			substituted := false
+			alts := make([][]string, 0)
+			for _, alt := range c.alts[ai] {
+				if len(alt) == 0 || alt[0] != aj {
+					alts = append(alts, alt)
+					continue
+				}
+				substituted = true
+				for _, delta := range c.alts[aj] {
+					alts = append(alts, concat(delta, alt[1:]))
+				}
+			}
+			if !substituted {
+				continue
+			}
+			before := c.productions(ai)
+			c.setAlts(ai, alts)
+			c.step(RemoveLeftRecursion, fmt.Sprintf("Substitute %s in %s", aj, ai), before, ai)
+		}
+		c.removeDirectLeftRecursion(ai)
+	}
+}
+
+// whether a nonterminal on the right of a production derives the empty
+// string, which hides a left recursion A -> B A, or a nonterminal derives
+// itself by unit productions. The empty production of a start symbol on no
+// right side is kept by the removal of the empty productions, and is harmless.
+func (c *cfgRules) hasEmptyOrCycle() bool {
+	for _, sym := range c.nullable().sorted() {
+		if c.onRight(sym) {
+			return true
+		}
+	}
+	for _, a := range c.names {
+		reach := []string{a}
+		for k := 0; k < len(reach); k++ {
+			for _, alt := range c.alts[reach[k]] {
+				if len(alt) != 1 || !c.isNonterminal(alt[0]) {
+					continue
+				}
+				if alt[0] == a {
+					return true
+				}
+				if !containsStr(reach, alt[0]) {
+					reach = append(reach, alt[0])
+				}
+			}
+		}
+	}
+	return false
+}
+
+// A -> A a | b is replaced by A -> b A_tail, A_tail -> a A_tail | <empty>
+func (c *cfgRules) removeDirectLeftRecursion(a string) {
+	recursive := make([][]string, 0)
+	others := make([][]string, 0)
+	for _, alt := range c.alts[a] {
+		if len(alt) > 0 && alt[0] == a {
+			recursive = append(recursive, alt[1:])
+		} else {
+			others = append(others, alt)
+		}
+	}
+	if len(recursive) == 0 {
+		return
+	}
+
+	before := c.productions(a)
+	tail := c.newName(a, "tail")
+	alts := make([][]string, 0, len(others))
+	for _, beta := range others {
+		alts = append(alts, concat(beta, []string{tail}))
+	}
+	c.setAlts(a, alts)
+	for _, alpha := range recursive {
+		// A -> A is a cycle which derives nothing more
+		if len(alpha) > 0 {
+			c.addAlt(tail, concat(alpha, []string{tail}))
+		}
+	}
+	c.addAlt(tail, []string{})
+	c.insertAfter(a, tail)
+	c.step(RemoveLeftRecursion, fmt.Sprintf("Eliminate the direct left recursion of %s", a), before, a, tail)
+}
+
+// A -> p b | p c is replaced by A -> p A_factor, A_factor -> b | c, with the
+// longest prefix p of the productions beginning with the same symbol. The new
+// nonterminals are factored too.
+func (c *cfgRules) leftFactor() {
+	for i := 0; i < len(c.names); i++ {
+		a := c.names[i]
+		for {
+			// the productions beginning with the first symbol shared
+			var group []int
+			for j, alt := range c.alts[a] {
+				if len(alt) == 0 {
+					continue
+				}
+				group = []int{j}
+				for k := j + 1; k < len(c.alts[a]); k++ {
+					if other := c.alts[a][k]; len(other) > 0 && other[0] == alt[0] {
+						group = append(group, k)
+					}
+				}
+				if len(group) > 1 {
+					break
+				}
+			}
+			if len(group) < 2 {
+				break
+			}
+
+			prefix := c.alts[a][group[0]]
+			for _, k := range group[1:] {
+				alt := c.alts[a][k]
+				n := 0
+				for n < len(prefix) && n < len(alt) && prefix[n] == alt[n] {
+					n++
+				}
+				prefix = prefix[:n]
+			}
+
+			before := c.productions(a)
+			name := c.newName(a, "factor")
+			suffixes := make([][]string, 0, len(group))
+			alts := make([][]string, 0)
+			for j, alt := range c.alts[a] {
+				switch {
+				case j == group[0]:
+					alts = append(alts, concat(prefix, []string{name}))
+					suffixes = append(suffixes, alt[len(prefix):])
+				case containsInt(group, j):
+					suffixes = append(suffixes, alt[len(prefix):])
+				default:
+					alts = append(alts, alt)
+				}
+			}
+			c.setAlts(a, alts)
+			c.setAlts(name, suffixes)
+			c.insertAfter(a, name)
+			c.step(LeftFactor, fmt.Sprintf("Factor %s out of %s", strings.Join(prefix, " "), a), before, a, name)
+		}
+	}
+}
+
+func containsInt(arr []int, x int) bool {
+	for _, y := range arr {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
+
+// A -> B is replaced by the productions of the nonterminals A derives by
+// unit productions which are not unit productions.
+func (c *cfgRules) removeUnitProductions() {
+	original := make(map[string][][]string)
+	for name, alts := range c.alts {
+		original[name] = alts
+	}
+	isUnit := func(alt []string) bool {
+		return len(alt) == 1 && c.isNonterminal(alt[0])
+	}
+
+	for _, a := range append([]string{}, c.names...) {
+		reach := []string{a}
+		hasUnit := false
+		for k := 0; k < len(reach); k++ {
+			for _, alt := range original[reach[k]] {
+				if !isUnit(alt) {
+					continue
+				}
+				hasUnit = true
+				if !containsStr(reach, alt[0]) {
+					reach = append(reach, alt[0])
+				}
+			}
+		}
+		if !hasUnit {
+			continue
+		}
+
+		before := c.productions(a)
+		alts := make([][]string, 0)
+		for _, b := range reach {
+			for _, alt := range original[b] {
+				if !isUnit(alt) {
+					alts = append(alts, alt)
+				}
+			}
+		}
+		c.setAlts(a, alts)
+		c.step(RemoveUnitProductions, fmt.Sprintf("Replace the unit productions of %s", a), before, a)
+	}
+}
+
+func containsStr(arr []string, s string) bool {
+	for _, x := range arr {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *cfgRules) nullable() *StrSet {
+	nullable := createSet()
+	for {
+		size := nullable.size()
+		for _, name := range c.names {
+			for _, alt := range c.alts[name] {
+				all := true
+				for _, sym := range alt {
+					if !nullable.contains(sym) {
+						all = false
+						break
+					}
+				}
+				if all {
+					nullable.add(name)
+				}
+			}
+		}
+		if nullable.size() == size {
+			return nullable
+		}
+	}
+}
+
+// Each production is replaced by its variants with and without each nullable
+// nonterminal, except the empty one.
+func (c *cfgRules) removeEmptyProductions() {
+	nullable := c.nullable()
+	if nullable.size() == 0 {
+		return
+	}
+
+	for _, a := range append([]string{}, c.names...) {
+		alts := make([][]string, 0)
+		for _, alt := range c.alts[a] {
+			variants := [][]string{{}}
+			for _, sym := range alt {
+				next := make([][]string, 0, len(variants)*2)
+				for _, v := range variants {
+					next = append(next, concat(v, []string{sym}))
+					if nullable.contains(sym) {
+						next = append(next, v)
+					}
+				}
+				variants = next
+			}
+			for _, v := range variants {
+				if len(v) > 0 {
+					alts = append(alts, v)
+				}
+			}
+		}
+		before := c.productions(a)
+		c.setAlts(a, alts)
+		if strings.Join(before, "\n") != strings.Join(c.productions(a), "\n") {
+			c.step(RemoveEmptyProductions, fmt.Sprintf("Remove the empty string from %s", a), before, a)
+		}
+	}
+
+	// the nonterminals which only derived the empty string are gone, and so
+	// are the productions using them
+	for removed := true; removed; {
+		removed = false
+		for _, a := range append([]string{}, c.names...) {
+			alts := make([][]string, 0)
+			for _, alt := range c.alts[a] {
+				defined := true
+				for _, sym := range alt {
+					if !c.terminals[sym] && !c.isNonterminal(sym) {
+						defined = false
+						break
+					}
+				}
+				if defined {
+					alts = append(alts, alt)
+				}
+			}
+			if len(alts) != len(c.alts[a]) {
+				c.setAlts(a, alts)
+				removed = true
+			}
+		}
+	}
+
+	if !nullable.contains(c.start) {
+		return
+	}
+	if c.isNonterminal(c.start) && !c.onRight(c.start) {
+		before := c.productions(c.start)
+		c.addAlt(c.start, []string{})
+		c.step(RemoveEmptyProductions, fmt.Sprintf("Keep the empty string in the start symbol %s", c.start), before, c.start)
+		return
+	}
+	start := c.newName(c.start, "start")
+	c.names = append([]string{start}, c.names...)
+	c.alts[start] = [][]string{}
+	if c.isNonterminal(c.start) {
+		c.addAlt(start, []string{c.start})
+	}
+	c.addAlt(start, []string{})
+	c.step(RemoveEmptyProductions, fmt.Sprintf("Derive the empty string from the new start symbol %s", start), []string{}, start)
+	c.start = start
+}
+
+// whether sym is in the right side of a production
+func (c *cfgRules) onRight(sym string) bool {
+	for _, name := range c.names {
+		for _, alt := range c.alts[name] {
+			if containsStr(alt, sym) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *cfgRules) apply(t Transform) {
+	switch t {
+	case RemoveLeftRecursion:
+		c.removeLeftRecursion()
+	case LeftFactor:
+		c.leftFactor()
+	case RemoveUnitProductions:
+		c.removeUnitProductions()
+	case RemoveEmptyProductions:
+		c.removeEmptyProductions()
+	default:
+		c.chomskyNormalForm()
+	}
+}
+
+func (c *cfgRules) syntaxRules() []*SyntaxRule[any] {
+	rules := make([]*SyntaxRule[any], 0, len(c.names))
+	for _, name := range c.names {
+		expand := make([]*RuleOps[any], 0, len(c.alts[name]))
+		for _, alt := range c.alts[name] {
+			expand = append(expand, &RuleOps[any]{Ops: strings.Join(alt, " ")})
+		}
+		rules = append(rules, &SyntaxRule[any]{Name: name, Expand: expand})
+	}
+	return rules
+}
+
+// Apply the transforms to the rules of the parser in order. The actions of
+// the rules are not kept, since the productions they belong to are rewritten.
+func (p *Parser[T]) Rewrite(transforms ...Transform) *Rewrite {
+	c := rulesOf(p.grammar)
+	for i, t := range transforms {
+		c.pass = i
+		c.apply(t)
+	}
+	return &Rewrite{
+		Rules:      c.syntaxRules(),
+		Steps:      c.steps,
+		transforms: transforms,
+	}
+}
+
+func (p *LLParser[T]) Rewrite(transforms ...Transform) *Rewrite {
+	return p.parser.Rewrite(transforms...)
+}
+
+func (p *EarleyParser[T]) Rewrite(transforms ...Transform) *Rewrite {
+	return p.parser.Rewrite(transforms...)
+}
+
+// The trace of the rewrite: the steps of each transform, and the rules found
+func (r *Rewrite) MD() string {
+	result := "# Grammar Transformations\n"
+	result += "\n"
+	for i, t := range r.transforms {
+		result += fmt.Sprintf("## %s\n", t)
+		result += "\n"
+		steps := 0
+		for _, step := range r.Steps {
+			if step.pass != i {
+				continue
+			}
+			steps++
+			result += fmt.Sprintf("### %s\n", step.Title)
+			result += "\n"
+			if len(step.Before) > 0 {
+				result += "Before:\n"
+				result += "\n"
+				for _, prod := range step.Before {
+					result += fmt.Sprintf("- %s\n", prod)
+				}
+				result += "\n"
+			}
+			if len(step.After) > 0 {
+				result += "After:\n"
+				result += "\n"
+				for _, prod := range step.After {
+					result += fmt.Sprintf("- %s\n", prod)
+				}
+				result += "\n"
+			}
+		}
+		if steps == 0 {
+			result += "No production is rewritten.\n"
+			result += "\n"
+		}
+	}
+
+	result += "## Rules\n"
+	result += "\n"
+	for _, rule := range r.Rules {
+		for _, ops := range rule.Expand {
+			result += fmt.Sprintf("- %s\n", altString(rule.Name, strings.Fields(ops.Ops)))
+		}
+	}
+	result += "\n"
+	return result
+}
+
+func (r *Rewrite) WriteMD(name string, path string) {
+	writeMD(name, path, r.MD())
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the productions of the rules, as altString renders them
+func ruleStrings(rules []*SyntaxRule[any]) []string {
+	result := make([]string, 0)
+	for _, rule := range rules {
+		for _, ops := range rule.Expand {
+			result = append(result, altString(rule.Name, strings.Fields(ops.Ops)))
+		}
+	}
+	return result
+}
+
+func expectRules(t *testing.T, rules []*SyntaxRule[any], expected []string) {
+	t.Helper()
+	got := ruleStrings(rules)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRemoveLeftRecursion(t *testing.T) {
+	p := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	r := p.Rewrite(RemoveLeftRecursion)
+	expectRules(t, r.Rules, []string{
+		"expr -> term expr_tail",
+		"expr_tail -> PLUS term expr_tail",
+		"expr_tail -> <empty>",
+		"term -> factor term_tail",
+		"term_tail -> TIMES factor term_tail",
+		"term_tail -> <empty>",
+		"factor -> NUMBER",
+		"factor -> LPAREN expr RPAREN",
+	})
+	if len(r.Steps) != 2 || r.Steps[0].Title != "Eliminate the direct left recursion of expr" {
+		t.Errorf("Unexpected steps %v", r.Steps)
+	}
+
+	// the rules are LL(1) now
+	ll := CreateLLParser(earleySymbols, []string{" "}, r.Rules, []*Precedence{})
+	if len(ll.Conflicts()) != 0 {
+		t.Errorf("Expected no conflict, got %v", ll.Conflicts())
+	}
+	if _, err := ll.ParseTree("(1 + 2) * 3"); err != nil {
+		t.Error(err)
+	}
+
+	// the indirect recursion s -> a PLUS, a -> s LPAREN
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "a PLUS"},
+				{Ops: "NUMBER"},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any]{
+				{Ops: "a TIMES"},
+				{Ops: "s LPAREN"},
+				{Ops: "RPAREN"},
+			},
+		},
+	}
+	e := CreateEarleyParser(earleySymbols, []string{" "}, rules, []*Precedence{})
+	r = e.Rewrite(RemoveLeftRecursion)
+	expectRules(t, r.Rules, []string{
+		"s -> a PLUS",
+		"s -> NUMBER",
+		"a -> NUMBER LPAREN a_tail",
+		"a -> RPAREN a_tail",
+		"a_tail -> TIMES a_tail",
+		"a_tail -> PLUS LPAREN a_tail",
+		"a_tail -> <empty>",
+	})
+	if r.Steps[0].Title != "Substitute s in a" {
+		t.Errorf("Unexpected step %s", r.Steps[0].Title)
+	}
+}
+
+func TestRemoveLeftRecursionPrecondition(t *testing.T) {
+	// the left recursion of s is hidden by the empty production of b, and a
+	// and c are a cycle
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "b s PLUS"},
+				{Ops: "a"},
+			},
+		},
+		{
+			Name: "b",
+			Expand: []*RuleOps[any]{
+				{Ops: "LPAREN"},
+				{Ops: ""},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any]{
+				{Ops: "c"},
+				{Ops: "NUMBER"},
+			},
+		},
+		{
+			Name: "c",
+			Expand: []*RuleOps[any]{
+				{Ops: "a"},
+				{Ops: "TIMES"},
+			},
+		},
+	}
+	e := CreateEarleyParser(earleySymbols, []string{" "}, rules, []*Precedence{})
+	r := e.Rewrite(RemoveLeftRecursion)
+	for _, rule := range r.Rules {
+		for _, ops := range rule.Expand {
+			if strings.HasPrefix(ops.Ops+" ", rule.Name+" ") {
+				t.Errorf("Expected no direct left recursion, got %s", altString(rule.Name, strings.Fields(ops.Ops)))
+			}
+		}
+	}
+	if r.Steps[0].Transform != RemoveLeftRecursion || !strings.Contains(r.Steps[0].Title, "empty productions and the cycles") {
+		t.Errorf("Unexpected step %s", r.Steps[0].Title)
+	}
+	for _, step := range r.Steps {
+		if step.Transform != RemoveLeftRecursion {
+			t.Errorf("Expected the step %s in the trace of the transform", step.Title)
+		}
+	}
+
+	rewritten := CreateEarleyParser(earleySymbols, []string{" "}, r.Rules, []*Precedence{})
+	for _, input := range []string{"1", "*", "1 +", "( 1 + +", "( ( * + +"} {
+		if _, err := rewritten.ParseForest(input); err != nil {
+			t.Errorf("Expected %s parsed: %v", input, err)
+		}
+	}
+}
+
+func TestRewriteTemplateNames(t *testing.T) {
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "LPAREN separated_nonempty_list(PLUS, NUMBER) RPAREN"},
+			},
+		},
+	}
+	e := CreateEarleyParser(earleySymbols, []string{" "}, rules, []*Precedence{})
+	r := e.Rewrite(RemoveLeftRecursion)
+	expectRules(t, r.Rules, []string{
+		"s -> LPAREN separated_nonempty_list_PLUS_NUMBER RPAREN",
+		"separated_nonempty_list_PLUS_NUMBER -> NUMBER separated_nonempty_list_PLUS_NUMBER_tail",
+		"separated_nonempty_list_PLUS_NUMBER_tail -> PLUS NUMBER separated_nonempty_list_PLUS_NUMBER_tail",
+		"separated_nonempty_list_PLUS_NUMBER_tail -> <empty>",
+	})
+	// the names of the rewritten rules are read again
+	rewritten := CreateEarleyParser(earleySymbols, []string{" "}, r.Rules, []*Precedence{})
+	if _, err := rewritten.ParseForest("(1 + 2 + 3)"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLeftFactor(t *testing.T) {
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "stmt",
+			Expand: []*RuleOps[any]{
+				{Ops: "IF NAME THEN stmt"},
+				{Ops: "IF NAME THEN stmt ELSE stmt"},
+				{Ops: "NAME"},
+			},
+		},
+	}
+	p := CreateEarleyParser(conflictSymbols, []string{" "}, rules, []*Precedence{})
+	r := p.Rewrite(LeftFactor)
+	expectRules(t, r.Rules, []string{
+		"stmt -> IF NAME THEN stmt stmt_factor",
+		"stmt -> NAME",
+		"stmt_factor -> <empty>",
+		"stmt_factor -> ELSE stmt",
+	})
+
+	// the new nonterminals are factored too
+	rules = []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "NAME PLUS NAME"},
+				{Ops: "NAME PLUS NUMBER"},
+				{Ops: "NAME"},
+			},
+		},
+	}
+	p = CreateEarleyParser(conflictSymbols, []string{" "}, rules, []*Precedence{})
+	expectRules(t, p.Rewrite(LeftFactor).Rules, []string{
+		"s -> NAME s_factor",
+		"s_factor -> PLUS s_factor_factor",
+		"s_factor -> <empty>",
+		"s_factor_factor -> NAME",
+		"s_factor_factor -> NUMBER",
+	})
+}
+
+func TestRemoveUnitProductions(t *testing.T) {
+	p := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	expectRules(t, p.Rewrite(RemoveUnitProductions).Rules, []string{
+		"expr -> expr PLUS term",
+		"expr -> term TIMES factor",
+		"expr -> NUMBER",
+		"expr -> LPAREN expr RPAREN",
+		"term -> term TIMES factor",
+		"term -> NUMBER",
+		"term -> LPAREN expr RPAREN",
+		"factor -> NUMBER",
+		"factor -> LPAREN expr RPAREN",
+	})
+}
+
+func TestRemoveEmptyProductions(t *testing.T) {
+	p := CreateParser(earleySymbols, []string{" "}, createLLRules(), []*Precedence{})
+	expectRules(t, p.Rewrite(RemoveEmptyProductions).Rules, []string{
+		"expr -> term sum",
+		"expr -> term",
+		"sum -> PLUS term sum",
+		"sum -> PLUS term",
+		"term -> factor product",
+		"term -> factor",
+		"product -> TIMES factor product",
+		"product -> TIMES factor",
+		"factor -> NUMBER",
+		"factor -> LPAREN expr RPAREN",
+	})
+
+	// the start symbol is nullable and recursive, a only derives the empty
+	// string
+	rules := []*SyntaxRule[any]{
+		{
+			Name: "s",
+			Expand: []*RuleOps[any]{
+				{Ops: "LPAREN s RPAREN s"},
+				{Ops: "a"},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any]{
+				{Ops: ""},
+			},
+		},
+	}
+	e := CreateEarleyParser(earleySymbols, []string{" "}, rules, []*Precedence{})
+	r := e.Rewrite(RemoveEmptyProductions)
+	expectRules(t, r.Rules, []string{
+		"s_start -> s",
+		"s_start -> <empty>",
+		"s -> LPAREN s RPAREN s",
+		"s -> LPAREN s RPAREN",
+		"s -> LPAREN RPAREN s",
+		"s -> LPAREN RPAREN",
+	})
+
+	// the language is the same
+	balanced := CreateEarleyParser(earleySymbols, []string{" "}, r.Rules, []*Precedence{})
+	for _, s := range []string{"", "()", "(()) ()"} {
+		if _, err := balanced.ParseTree(s); err != nil {
+			t.Errorf("Expected a parse of %q, got %v", s, err)
+		}
+	}
+	if _, err := balanced.ParseTree("(()"); err == nil {
+		t.Errorf("Expected a syntax error")
+	}
+}
+
+func TestRewriteMD(t *testing.T) {
+	dir := t.TempDir()
+	p := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	p.Rewrite(RemoveLeftRecursion, LeftFactor).WriteMD("rewrite", dir)
+
+	content, err := os.ReadFile(filepath.Join(dir, "rewrite.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(content)
+	for _, s := range []string{
+		"# Grammar Transformations",
+		"## Remove Left Recursion\n\n### Eliminate the direct left recursion of expr\n\nBefore:\n\n- expr -> expr PLUS term\n- expr -> term\n\nAfter:\n\n- expr -> term expr_tail\n",
+		"## Left Factor\n\nNo production is rewritten.\n",
+		"## Rules\n\n- expr -> term expr_tail\n",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("Expected %s in\n%s", s, md)
+		}
+	}
+}
+
+func TestRewriteMDPasses(t *testing.T) {
+	p := CreateParser(earleySymbols, []string{" "}, createTermRules(), []*Precedence{})
+	// the second pass finds no unit production, and the steps of the first
+	// one are not repeated in its section
+	md := p.Rewrite(RemoveUnitProductions, RemoveUnitProductions).MD()
+	if n := strings.Count(md, "### Replace the unit productions of expr"); n != 1 {
+		t.Errorf("Expected the step once, got %d in\n%s", n, md)
+	}
+	if !strings.Contains(md, "## Remove Unit Productions\n\nNo production is rewritten.\n") {
+		t.Errorf("Expected the second pass without steps in\n%s", md)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position of a node in the input. Start and End are byte offsets, End is
+// exclusive.
+type Span struct {
+	Start     int
+	End       int
+	StartLine int
+	EndLine   int
+}
+
+// Node of the concrete syntax tree. An inner node is the reduction of the
+// production of Rule, a leaf holds a Token or the value computed by the action
+// of a production.
+type Node struct {
+	Rule       string // nonterminal, or token type of a leaf
+	Production int    // id of the production, -1 for a leaf
+	Children   []*Node
+	Span       Span
+	Token      *Token
+	Value      any
+}
+
+// Parse s and return its concrete syntax tree. The actions of the rules are
+// not invoked.
+func (p *Parser[T]) ParseTree(s string) (*Node, error) {
+	tokens, tokenErr := p.Tokenize(s)
+	if tokenErr != nil {
+		return nil, tokenErr
+	}
+	return p.ParseTokenTree(tokens)
+}
+
+func (p *Parser[T]) ParseTokenTree(tokens []*Token) (*Node, error) {
+	result, err := p.parseToken(tokens, true)
+	if err != nil {
+		return nil, err
+	}
+	return result.Node, nil
+}
+
+func (n *Node) IsLeaf() bool {
+	return n.Production < 0
+}
+
+// Print the tree in s-expression, e.g. (expr (expr NUMBER:1) PLUS:+ (expr NUMBER:2))
+func (n *Node) String() string {
+	if n.Token != nil {
+		return fmt.Sprintf("%s:%s", n.Rule, n.Token.Value)
+	}
+	// value of an action
+	if n.IsLeaf() && n.Children == nil {
+		return fmt.Sprintf("%s:%v", n.Rule, n.Value)
+	}
+
+	children := make([]string, 0)
+	for _, child := range n.Children {
+		children = append(children, child.String())
+	}
+	if len(children) == 0 {
+		return fmt.Sprintf("(%s)", n.Rule)
+	}
+	return fmt.Sprintf("(%s %s)", n.Rule, strings.Join(children, " "))
+}
+
+func tokenSpan(t *Token) Span {
+	return Span{
+		Start:     t.Index,
+		End:       t.End,
+		StartLine: t.Lineno,
+		EndLine:   t.Lineno,
+	}
+}
+
+// The span of a production covers the spans of its symbols. An empty
+// production is located right before the lookahead token.
+func joinSpans(spans []Span, lookahead *Token) Span {
+	if len(spans) == 0 {
+		return Span{
+			Start:     lookahead.Index,
+			End:       lookahead.Index,
+			StartLine: lookahead.Lineno,
+			EndLine:   lookahead.Lineno,
+		}
+	}
+	return Span{
+		Start:     spans[0].Start,
+		End:       spans[len(spans)-1].End,
+		StartLine: spans[0].StartLine,
+		EndLine:   spans[len(spans)-1].EndLine,
+	}
+}
+
+func createNode[T any](prod *production, vals []Value[T], spans []Span, span Span) *Node {
+	node := &Node{
+		Rule:       prod.name,
+		Production: prod.id,
+		Children:   make([]*Node, 0, len(vals)),
+		Span:       span,
+	}
+	for i, v := range vals {
+		// the hidden nonterminals of the mid-rule actions are not in the tree
+		if strings.HasPrefix(prod.prod[i], "$@") {
+			continue
+		}
+		node.Children = append(node.Children, valueNode(prod.prod[i], v, spans[i]))
+	}
+	return node
+}
+
+// turn the value of symbol sym into a node
+func valueNode[T any](sym string, v Value[T], span Span) *Node {
+	if v.Node != nil {
+		return v.Node
+	}
+	if v.Token != nil {
+		return &Node{
+			Rule:       v.Token.Type,
+			Production: -1,
+			Span:       tokenSpan(v.Token),
+			Token:      v.Token,
+		}
+	}
+	if v.Items != nil {
+		items := make([]*Node, 0, len(v.Items))
+		for _, item := range v.Items {
+			items = append(items, valueNode(sym, item, span))
+		}
+		return &Node{
+			Rule:       sym,
+			Production: -1,
+			Children:   items,
+			Span:       span,
+		}
+	}
+	return &Node{
+		Rule:       sym,
+		Production: -1,
+		Span:       span,
+		Value:      v.Val,
+	}
+}
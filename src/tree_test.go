@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func createTreeParser() *Parser[int] {
+	symbols := map[string]string{
+		"NAME":     "[a-zA-Z_][a-zA-Z0-9_]*",
+		"NUMBER":   "[0-9]+",
+		"PLUS":     "\\+",
+		"MULTIPLY": "\\*",
+		"COMMA":    ",",
+		"LPAREN":   "\\(",
+		"RPAREN":   "\\)",
+	}
+
+	precedences := []*Precedence{
+		{
+			TokenType: []string{"PLUS"},
+			Level:     1,
+		},
+		{
+			TokenType: []string{"MULTIPLY"},
+			Level:     2,
+		},
+	}
+
+	rules := []*SyntaxRule[int]{
+		{
+			Name: "statement",
+			Expand: []*RuleOps[int]{
+				{Ops: "expr"},
+				{Ops: "NAME LPAREN separated_list(COMMA, expr) RPAREN"},
+			},
+		},
+		{
+			Name: "expr",
+			Expand: []*RuleOps[int]{
+				{Ops: "expr PLUS expr"},
+				{Ops: "expr MULTIPLY expr"},
+				{Ops: "LPAREN expr RPAREN"},
+				{
+					Ops: "NUMBER",
+					RFunc: func(vals []Value[int]) (int, error) {
+						return strconv.Atoi(vals[0].Token.Value)
+					},
+				},
+			},
+		},
+	}
+
+	return CreateParser(symbols, []string{" ", "\t"}, rules, precedences)
+}
+
+func TestParseTree(t *testing.T) {
+	p := createTreeParser()
+
+	cases := map[string]string{
+		"1 + 2 * 3": "(statement (expr (expr NUMBER:1) PLUS:+ (expr (expr NUMBER:2) MULTIPLY:* (expr NUMBER:3))))",
+		"(1 + 2)":   "(statement (expr LPAREN:( (expr (expr NUMBER:1) PLUS:+ (expr NUMBER:2)) RPAREN:)))",
+		"f()":       "(statement NAME:f LPAREN:( (separated_list(COMMA,expr)) RPAREN:))",
+	}
+	for input, expected := range cases {
+		tree, err := p.ParseTree(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		fmt.Println(tree.String())
+		if tree.String() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, tree.String())
+		}
+	}
+
+	tree, err := p.ParseTree("1 +\n 23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr := tree.Children[0]
+	if expr.Span.Start != 0 || expr.Span.End != 7 || expr.Span.StartLine != 1 || expr.Span.EndLine != 2 {
+		t.Errorf("Unexpected span %+v", expr.Span)
+	}
+	if expr.Production != p.grammar.prodNames["expr"][0].id {
+		t.Errorf("Unexpected production %d", expr.Production)
+	}
+}
+
+func TestMixedTree(t *testing.T) {
+	p := createTreeParser()
+
+	// only expr -> NUMBER has an action, so its values are the leaves. The
+	// items of the list are named after the list
+	tokens, _ := p.Tokenize("f(1, 2 + 3)")
+	result, err := p.parseToken(tokens, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "(statement NAME:f LPAREN:( (separated_list(COMMA,expr) separated_list(COMMA,expr):1 (expr expr:2 PLUS:+ expr:3)) RPAREN:))"
+	if result.Node.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.Node.String())
+	}
+}
@@ -1,50 +1,48 @@
 package main
 
 import (
-	"crypto/md5"
-	"encoding/binary"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const EMPTYTOKEN = "<empty>"
 const ENDTOKEN = "$end"
 
-type Parser struct {
+// Parser of the grammar whose semantic values are of type T.
+type Parser[T any] struct {
 	lexer *Lexer
 	grammar *grammar
 	table *lrTable
-}
-
-// Interface of handling value in stack during parsing. The conversion of the value need to be handled by developer.
-type PValue interface {
-	TypeName() string
-	GetValue() []byte
-	GetLine() int
+	// semantics function of each production, indexed by production id
+	actions []func([]Value[T]) (Value[T], error)
+	// the actions of the GLR driver, built by its first parse
+	glr [][][]int32
+	glrOnce sync.Once
+	// the table with its LR states, see lrStates
+	states *lrTable
+	statesOnce sync.Once
 }
 
 // This struct implements the LR table generation algorithm.
 type lrTable struct {
 	grammar *grammar
-	addCount int // Internal counter used to detect cycles
+	method TableMethod
 	closures [][]*LRItem
-	closureMap map[int]int // map hash of lr closure to index of lr closure
+	states *itemSets // the interned LR(0) states
+	transitions map[int]map[string]int // state: symbol: next state
 	lrAction map[int]map[string]string
 	lrGoto map[int]map[string]int
+	tables *parseTables // the integer encoding of lrAction and lrGoto
 	lrProductions []*production
 	actionProductions map[int]map[string]*LRItem
-	// Cache of computed gotos
-	lrGotoCache map[string][]*LRItem
-	symbolGotoCache map[string]*symbolCache
-}
-
-type symbolCache struct {
-	transfer map[int]int
-	end []*LRItem
+	lookaheads map[*LRItem]map[int]*StrSet // item: state: lookaheads
+	conflicts []*conflict
+	workers int // goroutines building the table, 0 is runtime.GOMAXPROCS
 }
 
 type looked struct {
@@ -59,20 +57,39 @@ type production struct{
 	prodSize int
 	symSet *StrSet
 	precLevel int
-	pFunc func([]PValue) (PValue, error)
+	action any // func([]Value[T]) (Value[T], error) of the Parser[T]
+	labels map[string]int // label: position in prod
+	// The hidden empty production of a mid-rule action is reduced with the
+	// midDepth values before it, midOf describes the action and its rule.
+	midDepth int
+	midOf string
 	lrItems []*LRItem
 	lrNext *LRItem
-	lr0Added int
 }
 
-type RuleOps struct {
+type RuleOps[T any] struct {
 	Ops string
-	RFunc    func([]PValue) (PValue, error)
+	RFunc    func([]Value[T]) (T, error)
+	// Action is the alternative of RFunc which reads the values by the labels
+	// in Ops, e.g. "lhs=expr PLUS rhs=expr". The labels read by the action must
+	// be listed in Refs, which are checked when the grammar is created.
+	Action func(*ActionCtx[T]) (T, error)
+	Refs   []string
+	// Name of the AST node of this alternative for GenerateAST. The labelled
+	// symbols become the fields of the node.
+	ASTNode string
+	// Mid-rule actions, placed in Ops by {Name}
+	Mid []*MidAction[T]
+	// used by the standard templates which return lists instead of T
+	vFunc func([]Value[T]) (Value[T], error)
 }
 
-type SyntaxRule struct {
+type SyntaxRule[T any] struct {
 	Name   string
-	Expand []*RuleOps
+	// Parameters of a template rule. A rule with params is instantiated on use,
+	// e.g. separated_list(COMMA, expr)
+	Params []string
+	Expand []*RuleOps[T]
 }
 
 type grammar struct {
@@ -91,6 +108,7 @@ type grammar struct {
 	precedence   map[string]int // Tokentype: level
 	usedPrecedence *StrSet
 	start        string
+	midCount     int // number of the mid-rule actions
 }
 
 type Precedence struct {
@@ -110,46 +128,108 @@ type LRItem struct {
 	lrNext *LRItem
 	lrAfter []*production
 	lrBefore string
-	lookaheads map[int]*StrSet
 	len int
 	symSet *StrSet
 }
 
-func CreateParser(lrules map[string]string, ignore []string, srules []*SyntaxRule, precedence []*Precedence) *Parser {
+// Option of the creation of a parser, e.g. the TableMethod
+type Option interface {
+	apply(c *parserConfig)
+}
+
+type parserConfig struct {
+	method TableMethod
+	expect *Expect
+	cacheDir string
+	workers int
+}
+
+func CreateParser[T any](lrules map[string]string, ignore []string, srules []*SyntaxRule[T], precedence []*Precedence, opts ...Option) *Parser[T] {
+	config := &parserConfig{
+		method: LALR1,
+	}
+	for _, opt := range opts {
+		opt.apply(config)
+	}
+
 	lexer := CreateLexer(lrules, ignore)
+	if config.cacheDir != "" {
+		return createCachedParser(config, lrules, ignore, lexer, srules, precedence)
+	}
 	grammar := CreateGrammar(lexer, srules, precedence)
-	table := createLRTable(grammar)
-	return &Parser{
+	table := buildParallelLRTable(grammar, config.method, config.workers)
+	table.checkConflicts(config.expect)
+
+	return newParser[T](lexer, grammar, table)
+}
+
+func newParser[T any](lexer *Lexer, grammar *grammar, table *lrTable) *Parser[T] {
+	actions := make([]func([]Value[T]) (Value[T], error), len(grammar.productions))
+	for i, prod := range grammar.productions {
+		if prod.action != nil {
+			actions[i] = prod.action.(func([]Value[T]) (Value[T], error))
+		}
+	}
+
+	return &Parser[T]{
 		lexer: lexer,
 		grammar: grammar,
 		table: table,
+		actions: actions,
 	}
 }
 
-func (p *Parser) Parse(s string) (PValue,error) {
+func (p *Parser[T]) Parse(s string) (T, error) {
 	t, tokenErr := p.Tokenize(s)
 	if tokenErr != nil {
-		return nil, tokenErr
+		var zero T
+		return zero, tokenErr
 	}
 	return p.ParseToken(t)
 }
 
-func (p *Parser) ParseToken(tokens []*Token) (PValue, error) {
-	actions := p.table.lrAction
-	lGoto := p.table.lrGoto
+func (p *Parser[T]) ParseToken(tokens []*Token) (T, error) {
+	result, err := p.parseToken(tokens, false)
+	return result.Val, err
+}
+
+// A copy of tokens followed by the end token, which is at the end of the
+// last token
+func withEndToken(tokens []*Token) []*Token {
+	endToken := &Token{
+		Type:   ENDTOKEN,
+		Lineno: 0,
+	}
+	if len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		endToken.Index = last.End
+		endToken.End = last.End
+		endToken.Lineno = last.Lineno
+	}
+	return append(append([]*Token{}, tokens...), endToken)
+}
+
+// Run the LR driver over tokens. The productions without semantics function
+// build a Node of the concrete syntax tree instead, and so do all the
+// productions if treeOnly is set.
+func (p *Parser[T]) parseToken(tokens []*Token, treeOnly bool) (Value[T], error) {
+	tables := p.table.tables
 	productions := p.grammar.productions
 
 	current := -1
 	state := 0
 	stateStack := []int {0}
-	endToken := &Token {
-		Type: ENDTOKEN,
-		Lineno: 0,
+	tokens = withEndToken(tokens)
+	endToken := tokens[len(tokens)-1]
+	valStack := []Value[T] {
+		{Token: endToken},
 	}
-	valStack := []PValue {
-		endToken,
+	// the position of each value in the input, parallel to valStack
+	spanStack := []Span {
+		tokenSpan(endToken),
 	}
-	tokens = append(tokens, endToken)
+	var zero Value[T]
+	terms := tables.tokenTerminals(tokens)
 
 	// util func
 	nextToken := func() *Token {
@@ -165,47 +245,62 @@ func (p *Parser) ParseToken(tokens []*Token) (PValue, error) {
 
 	for {
 		// check actionTable
-		action, ok := actions[state][currentToken.Type]
+		action := tables.actionOf(state, terms[current])
 
-		if ok {
+		if action != errorAction {
 			// shift
-			if action[0] == 's' {
-				nextState := turnAction2id(action)
+			if action > 0 {
+				nextState := int(action - 1)
 				state = nextState
 				if currentToken.Type != ENDTOKEN {
 					stateStack = append(stateStack, nextState)
-					valStack = append(valStack, currentToken)
+					valStack = append(valStack, Value[T]{Token: currentToken})
+					spanStack = append(spanStack, tokenSpan(currentToken))
 					currentToken = nextToken()
 				}
 				continue
-			} else if action[0] == 'r' {
+			} else if action != acceptAction {
 				// reduce
-				ruleId := turnAction2id(action)
+				ruleId := int(-action - 1)
 				prod := productions[ruleId]
 				popTimes := prod.prodSize
 				vals, newValStack := sliceStack(valStack, popTimes)
 				valStack = newValStack
-				if prod.pFunc == nil {
-					panic(fmt.Sprintf("Rule %s has no semantics function", prod.name))
-				}
-				returned, semanticsErr := prod.pFunc(vals)
-				if semanticsErr != nil {
-					msg := fmt.Sprintf("Semantics Error: %s, line %d", semanticsErr.Error(), currentToken.Lineno)
-					return nil, fmt.Errorf(msg)
+				spans, newSpanStack := sliceStack(spanStack, popTimes)
+				spanStack = newSpanStack
+				span := joinSpans(spans, currentToken)
+
+				var returned Value[T]
+				action := p.actions[ruleId]
+				if treeOnly || action == nil {
+					returned = Value[T]{
+						Node: createNode(prod, vals, spans, span),
+					}
+				} else {
+					if prod.midDepth > 0 {
+						vals = valStack[len(valStack)-prod.midDepth:]
+					}
+					var semanticsErr error
+					returned, semanticsErr = action(vals)
+					if semanticsErr != nil {
+						msg := fmt.Sprintf("Semantics Error: %s, line %d", semanticsErr.Error(), currentToken.Lineno)
+						return zero, fmt.Errorf(msg)
+					}
 				}
 				valStack = append(valStack, returned)
+				spanStack = append(spanStack, span)
 				
 				// pop state and goto next state
 				_, newStates := sliceStack(stateStack, popTimes)
 				stateStack = newStates
 				state = stateStack[len(stateStack)-1]
-				gotoState, ok := lGoto[state][prod.name]
-				if ok {
+				gotoState := tables.gotoOf(state, ruleId)
+				if gotoState >= 0 {
 					state = gotoState
 					stateStack = append(stateStack, gotoState)
 					continue
 				} else {
-					return nil, fmt.Errorf("syntax error at line %d, token %s %s", currentToken.Lineno, currentToken.Type, currentToken.Value)
+					return zero, fmt.Errorf("syntax error at line %d, token %s %s", currentToken.Lineno, currentToken.Type, currentToken.Value)
 				}
 			} else {
 				// accepted!
@@ -214,22 +309,53 @@ func (p *Parser) ParseToken(tokens []*Token) (PValue, error) {
 			}
 		} else {
 			// syntax error
-			return nil, fmt.Errorf("syntax error at line %d, token %s %s", currentToken.Lineno, currentToken.Type, currentToken.Value)
+			return zero, fmt.Errorf("syntax error at line %d, token %s %s", currentToken.Lineno, currentToken.Type, currentToken.Value)
 		}
 	}
 }
 
-func (p *Parser) Tokenize(s string) ([]*Token, error) {
+// The table of the parser with its LR states. A parser loaded from tables
+// has none, so they are built from its grammar the first time the reports,
+// Conflicts or the GLR driver need them. They are those of the parser which
+// serialized the tables, since the hash of the grammar is checked.
+func (p *Parser[T]) lrStates() *lrTable {
+	p.statesOnce.Do(func() {
+		p.states = p.table
+		if p.table.closures == nil {
+			p.grammar.prepare()
+			p.states = buildParallelLRTable(p.grammar, p.table.method, p.table.workers)
+		}
+	})
+	return p.states
+}
+
+func (p *Parser[T]) Tokenize(s string) ([]*Token, error) {
 	return p.lexer.Tokenize(s)
 }
 
 // write the info about lalr parse to markdown format, and store it
-func (p *Parser) WriteMDInfo(name string, path string) {
+func (p *Parser[T]) WriteMDInfo(name string, path string) {
 	result := ""
 	result = p.lexMD()
 	result += p.grammarMD()
 	result += p.lrTableMD()
+	result += p.tableSizeMD()
+	result += p.conflictsMD()
+	result += p.llMD(buildLLTable(p.grammar))
+	if p.table.method != LALR1 {
+		result += p.methodsMD(true, LALR1)
+	}
+
+	writeMD(name, path, result)
+}
+
+// Write the comparison of the table of the parser with the tables built by
+// methods, e.g. to see why a grammar is LALR(1) but not SLR(1)
+func (p *Parser[T]) WriteMethodsMD(name string, path string, methods ...TableMethod) {
+	writeMD(name, path, p.methodsMD(false, methods...))
+}
 
+func writeMD(name string, path string, result string) {
 	// write string to file
 	var mdPath string
 	if strings.Contains(name, ".md") {
@@ -251,7 +377,8 @@ func (p *Parser) WriteMDInfo(name string, path string) {
 	fmt.Printf("file %s is written successfully in %s\n", name, path)
 }
 
-func (p *Parser) lrTableMD() string {
+func (p *Parser[T]) lrTableMD() string {
+	table := p.lrStates()
 	result := "# LR Table\n"
 	result += "\n"
 
@@ -259,18 +386,16 @@ func (p *Parser) lrTableMD() string {
 	result += "## States\n"
 	result += "\n"
 
-	for i, closure := range p.table.closures {
+	for i, closure := range table.closures {
 		result += fmt.Sprintf("# <a id=S%d></a>S%d\n", i, i)
 		result += "\n"
 		for _, item := range closure {
 			result += fmt.Sprintf("- %s \n", item.String())
 			// lookahead
-			if item.lookaheads != nil {
-				if heads, ok := item.lookaheads[i]; ok {
-					result += "\n    lookahead: "
-					result += heads.string() + "\n"
-					result += "\n"
-				}
+			if heads, ok := table.lookaheads[item][i]; ok {
+				result += "\n    lookahead: "
+				result += heads.string() + "\n"
+				result += "\n"
 			}
 		}
 		result += "\n"
@@ -303,10 +428,10 @@ func (p *Parser) lrTableMD() string {
 	result += "|\n"
 
 	// table body
-	for i := range p.table.closures {
+	for i := range table.closures {
 		result += fmt.Sprintf("| [S%d](#S%d) ", i, i)
 		for _, term := range tArr {
-			action, ok := p.table.lrAction[i][term]
+			action, ok := table.lrAction[i][term]
 			if !ok {
 				result += "| none "
 				continue
@@ -345,10 +470,10 @@ func (p *Parser) lrTableMD() string {
 	result += "|\n"
 
 	// table body
-	for i := range p.table.closures {
+	for i := range table.closures {
 		result += fmt.Sprintf("| [S%d](#S%d) ", i, i)
 		for _, non := range nArr {
-			lgoto, ok := p.table.lrGoto[i][non]
+			lgoto, ok := table.lrGoto[i][non]
 			if ok {
 				result += fmt.Sprintf("| [s%d](#S%d) ", lgoto, lgoto)
 			} else {
@@ -361,7 +486,101 @@ func (p *Parser) lrTableMD() string {
 	return result
 }
 
-func (p *Parser) grammarMD() string {
+// Compare the table of the parser with the tables built by methods: the
+// number of states and of conflicts, the actions which differ if the tables
+// have the same states, and the conflicts found by only one of them. The
+// states are linked if linked is set, i.e. they are in the same document.
+func (p *Parser[T]) methodsMD(linked bool, methods ...TableMethod) string {
+	table := p.lrStates()
+	tables := []*lrTable{table}
+	for _, method := range methods {
+		tables = append(tables, buildLRTable(p.grammar, method))
+	}
+
+	stateRef := func(t *lrTable, state int) string {
+		if linked && t == table {
+			return fmt.Sprintf("[S%d](#S%d)", state, state)
+		}
+		return fmt.Sprintf("S%d", state)
+	}
+
+	result := "# Table Methods\n"
+	result += "\n"
+	result += "| Method | States | Shift/Reduce | Reduce/Reduce |\n"
+	result += "| --- | --- | --- | --- |\n"
+	for _, t := range tables {
+		sr, rr := t.countConflicts()
+		result += fmt.Sprintf("| %s | %d | %d | %d |\n", t.method, len(t.closures), sr, rr)
+	}
+	result += "\n"
+
+	terms := make([]string, 0)
+	for term := range p.grammar.terminals {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	for _, other := range tables[1:] {
+		pair := []*lrTable{table, other}
+		result += fmt.Sprintf("## %s and %s\n", table.method, other.method)
+		result += "\n"
+
+		// LR(0), SLR(1) and LALR(1) share the LR(0) states
+		if table.method.lr0States() && other.method.lr0States() {
+			result += "### Different Actions\n"
+			result += "\n"
+			result += fmt.Sprintf("| State | Lookahead | %s | %s |\n", table.method, other.method)
+			result += "| --- | --- | --- | --- |\n"
+			// an action chosen among a conflict is marked
+			cells := make([]*StrSet, len(pair))
+			for i, t := range pair {
+				cells[i] = createSet()
+				for _, c := range t.conflicts {
+					cells[i].add(fmt.Sprintf("%d-%s", c.state, c.lookahead))
+				}
+			}
+			action := func(i int, state int, term string) string {
+				a, ok := pair[i].lrAction[state][term]
+				if !ok {
+					a = "none"
+				}
+				if cells[i].contains(fmt.Sprintf("%d-%s", state, term)) {
+					a += " (conflict)"
+				}
+				return a
+			}
+
+			for i := range table.closures {
+				for _, term := range terms {
+					a, b := action(0, i, term), action(1, i, term)
+					if a != b {
+						result += fmt.Sprintf("| %s | %s | %s | %s |\n", stateRef(table, i), term, a, b)
+					}
+				}
+			}
+			result += "\n"
+		}
+
+		for i, t := range pair {
+			keys := createSet()
+			for _, c := range pair[1-i].conflicts {
+				keys.add(c.key())
+			}
+			result += fmt.Sprintf("### Conflicts only in %s\n", t.method)
+			result += "\n"
+			for _, c := range t.conflicts {
+				if !keys.contains(c.key()) {
+					result += fmt.Sprintf("- %s %s\n", stateRef(t, c.state), c.key())
+				}
+			}
+			result += "\n"
+		}
+	}
+
+	return result
+}
+
+func (p *Parser[T]) grammarMD() string {
 	result := "# Grammar\n"
 	result += "\n"
 
@@ -407,7 +626,7 @@ func (p *Parser) grammarMD() string {
 	return result
 }
 
-func (p *Parser) lexMD() string {
+func (p *Parser[T]) lexMD() string {
 	result := "# Lexer\n"
 	result += "\n"
 
@@ -420,136 +639,217 @@ func (p *Parser) lexMD() string {
 }
 
 
-func createLRTable(g *grammar) *lrTable {
+// Build the LR table of g by method, and warn about the conflicts which are
+// not resolved by the precedence.
+func createLRTable(g *grammar, method TableMethod) *lrTable {
+	table := buildLRTable(g, method)
+	table.checkConflicts(nil)
+	return table
+}
+
+// Build the LR table of g by method, and record the conflicts instead of
+// failing on them.
+func buildLRTable(g *grammar, method TableMethod) *lrTable {
+	return buildParallelLRTable(g, method, 0)
+}
+
+// Build the LR table of g by method on workers goroutines, 0 is
+// runtime.GOMAXPROCS. The table is the same for any number of workers.
+func buildParallelLRTable(g *grammar, method TableMethod, workers int) *lrTable {
 	table := &lrTable {
 		grammar: g,
-		addCount: 0,
-		closureMap: make(map[int]int),
+		method: method,
+		states: createItemSets(),
+		transitions: make(map[int]map[string]int),
 		lrAction: make(map[int]map[string]string),
 		lrGoto: make(map[int]map[string]int),
 		lrProductions: g.productions,
 		actionProductions: make(map[int]map[string]*LRItem),
-		lrGotoCache: make(map[string][]*LRItem),
-		symbolGotoCache: make(map[string]*symbolCache),
+		lookaheads: make(map[*LRItem]map[int]*StrSet),
+		conflicts: make([]*conflict, 0),
+		workers: workers,
 	}
 
-	// Step 1: Construct C = { I0, I1, ... IN}, collection of LR(0) items
-	// This determines the number of states
-	closures := table.lr0Items()
-	table.closures = closures
-	table.addLalrLookheads()
+	if method == LR1 || method == MinimalLR1 {
+		// the states and the lookaheads of the LR(1) items
+		table.lr1Items(method == MinimalLR1)
+	} else {
+		// Step 1: Construct C = { I0, I1, ... IN}, collection of LR(0) items
+		// This determines the number of states and their transitions
+		table.closures = table.lr0Items()
+
+		switch method {
+		case LR0:
+			table.addLR0Lookaheads()
+		case SLR1:
+			table.addSLRLookaheads()
+		default:
+			table.addLalrLookheads()
+		}
+	}
 
-	// Let's build LR Table!
-	// build the parser table, state by state
-	for cIndex, closure := range closures {
-		// loop over each production in I
-		stAction := make(map[string]string)
-		stActionItem := make(map[string]*LRItem)
+	table.buildActions()
+	table.sortConflicts()
+	table.tables = table.encode()
+	return table
+}
 
-		for _, lrItem := range closure {
-			// dotIndex to the end of the production. Reduce
-			if (lrItem.lrIndex + 1) == lrItem.len {
-				// Start symbol. Accept!
-				if lrItem.name == "S'" {
-					stAction[ENDTOKEN] = "accepted"
-					stActionItem[ENDTOKEN] = lrItem
-				} else {
-					// We are at the end of a production.  Reduce!
-					laHeads := lrItem.lookaheads[cIndex]
-					laHeads.forEach(func(head string) {
-						r, isHead := stAction[head]
-						if isHead {
-							// shift/ reduce conflict
-							if r[0] == 's' {
-								// precdence is the key to make decision. shift is favored.
-								sLevel := g.precedence[head]
-								rLevel := g.productions[lrItem.number].precLevel
-								// reduce
-								if rLevel > sLevel {
-									stAction[head] = fmt.Sprintf("r%d", lrItem.number)
-									stActionItem[head] = lrItem
-								}
-							} else {
-								// reduce/reduce conflict. Invoke panic!
-								oldl := stActionItem[head]
-								panic(fmt.Sprintf("reduce/reduce conflict between %s and %s in state %d",
-								 oldl.String(), lrItem.String(), cIndex))
+// The actions, gotos and conflicts of a state
+type stateActions struct {
+	action map[string]string
+	items map[string]*LRItem
+	gotos map[string]int
+	conflicts []*conflict
+}
+
+// Let's build LR Table!
+// build the parser table, the states in parallel, and merge them in order
+func (self *lrTable) buildActions() {
+	states := make([]*stateActions, len(self.closures))
+	self.parallel(len(self.closures), func(i int) {
+		states[i] = self.buildStateActions(i)
+	})
+
+	for cIndex, st := range states {
+		self.lrAction[cIndex] = st.action
+		self.lrGoto[cIndex] = st.gotos
+		self.actionProductions[cIndex] = st.items
+		self.conflicts = append(self.conflicts, st.conflicts...)
+	}
+}
+
+// build the actions of the state cIndex, it only reads the table
+func (self *lrTable) buildStateActions(cIndex int) *stateActions {
+	g := self.grammar
+	closure := self.closures[cIndex]
+	conflicts := make([]*conflict, 0)
+
+	// loop over each production in I
+	stAction := make(map[string]string)
+	stActionItem := make(map[string]*LRItem)
+	// every item reduced and the item shifted on each token, so that each
+	// reduce item is recorded in the shift/reduce conflict of the token
+	reduces := make(map[string][]*LRItem)
+	shifts := make(map[string]*LRItem)
+
+	for _, lrItem := range closure {
+		// dotIndex to the end of the production. Reduce
+		if (lrItem.lrIndex + 1) == lrItem.len {
+			// Start symbol. Accept!
+			if lrItem.name == "S'" {
+				stAction[ENDTOKEN] = "accepted"
+				stActionItem[ENDTOKEN] = lrItem
+			} else {
+				// We are at the end of a production.  Reduce!
+				laHeads, ok := self.lookaheads[lrItem][cIndex]
+				if !ok {
+					continue
+				}
+				laHeads.forEach(func(head string) {
+					r, isHead := stAction[head]
+					if isHead {
+						// shift/ reduce conflict
+						if r[0] == 's' {
+							// precdence is the key to make decision when both the
+							// token and the rule have one, as in yacc. shift is favored.
+							shifted := stActionItem[head]
+							winner := shifted
+							// reduce
+							if g.reduceFavored(head, lrItem) {
+								winner = lrItem
+								stAction[head] = fmt.Sprintf("r%d", lrItem.number)
+								stActionItem[head] = lrItem
 							}
+							conflicts = self.addConflict(conflicts, cIndex, head, shifted, lrItem, winner)
 						} else {
-							// just reduce
-							stAction[head] = fmt.Sprintf("r%d", lrItem.number)
-							stActionItem[head] = lrItem
+							// reduce/reduce conflict, the earlier production is favored
+							oldl := stActionItem[head]
+							winner := oldl
+							if lrItem.number < oldl.number {
+								winner = lrItem
+								stAction[head] = fmt.Sprintf("r%d", lrItem.number)
+								stActionItem[head] = lrItem
+							}
+							conflicts = self.addConflict(conflicts, cIndex, head, oldl, lrItem, winner)
+							// the shift lost to the earlier reduce item
+							if shifted, ok := shifts[head]; ok {
+								winner := shifted
+								if g.reduceFavored(head, lrItem) {
+									winner = lrItem
+								}
+								conflicts = self.addConflict(conflicts, cIndex, head, shifted, lrItem, winner)
+							}
 						}
-					})
-				}
-			} else {
-				// We are not at the end of a production.  Shift
-				i := lrItem.lrIndex
-				front := (*lrItem.prod)[i + 1] // get symbol right after "."
-				if _, ok := g.terminals[front]; ok {
-					sGoto := table.lr0Goto(closure, front)
-					var stateId int
-					if s, ok := table.closureMap[hashLRItems(sGoto)]; ok {
-						stateId = s
 					} else {
-						panic(fmt.Sprintf("LR0 goto state of %s not found in state %d", lrItem.String(), cIndex))
+						// just reduce
+						stAction[head] = fmt.Sprintf("r%d", lrItem.number)
+						stActionItem[head] = lrItem
 					}
-
-					if stateId >= 0 {
-						// shift state
-						if shift, ok := stAction[front]; ok {
-							// shift/shift conflict!
-							if shift[0] == 's' {
-								oldId := turnAction2id(shift)
-								if oldId != stateId {
-									panic(fmt.Sprintf("shift conflict between states %d and %d", cIndex, oldId))
-								}
-							} else if shift[0] == 'r' {
-								// reduce/shift conflict
-								oldl := g.productions[turnAction2id(shift)]
-								oldPrec := oldl.precLevel
-								prec := g.precedence[front]
-
-								if prec >= oldPrec  {
-									stAction[front] = fmt.Sprintf("s%d", stateId)
-									stActionItem[front] = lrItem
-								}
+					reduces[head] = append(reduces[head], lrItem)
+				})
+			}
+		} else {
+			// We are not at the end of a production.  Shift
+			i := lrItem.lrIndex
+			front := (*lrItem.prod)[i + 1] // get symbol right after "."
+			if _, ok := g.terminals[front]; ok {
+				stateId := self.transitions[cIndex][front]
+
+				// shift state
+				if shift, ok := stAction[front]; ok {
+					// shift/shift conflict!
+					if shift[0] == 's' {
+						oldId := turnAction2id(shift)
+						if oldId != stateId {
+							panic(fmt.Sprintf("shift conflict between states %d and %d", cIndex, oldId))
+						}
+					} else if shift[0] == 'r' {
+						// reduce/shift conflict with each item reduced on front
+						for _, reduced := range reduces[front] {
+							winner := lrItem
+							if g.reduceFavored(front, reduced) {
+								winner = reduced
 							}
-
-						} else {
+							conflicts = self.addConflict(conflicts, cIndex, front, lrItem, reduced, winner)
+						}
+						if !g.reduceFavored(front, stActionItem[front]) {
 							stAction[front] = fmt.Sprintf("s%d", stateId)
 							stActionItem[front] = lrItem
 						}
 					}
+
+				} else {
+					stAction[front] = fmt.Sprintf("s%d", stateId)
+					stActionItem[front] = lrItem
+				}
+				if _, ok := shifts[front]; !ok {
+					shifts[front] = lrItem
 				}
 			}
 		}
+	}
 
-		// construct goto table
-		stGoto := make(map[string]int)
-		nonTerminals := createSet()
-		for _, l := range closure {
-			l.symSet.forEach(func(s string){
-				if _, ok := g.nonterminals[s]; ok {
-					nonTerminals.add(s)
-				}
-			})
+	// construct goto table
+	stGoto := make(map[string]int)
+	for sym, gotoId := range self.transitions[cIndex] {
+		if _, ok := g.nonterminals[sym]; ok {
+			stGoto[sym] = gotoId
 		}
+	}
 
-		nonTerminals.forEach(func(nt string) {
-			gotoItems := table.lr0Goto(closure, nt)
-			gotoId := table.closureMap[hashLRItems(gotoItems)]
-			if gotoId >= 0 {
-				stGoto[nt] = gotoId
-			}
-		})
-
-		table.lrAction[cIndex] = stAction
-		table.lrGoto[cIndex] = stGoto
-		table.actionProductions[cIndex] = stActionItem
+	return &stateActions{
+		action: stAction,
+		items: stActionItem,
+		gotos: stGoto,
+		conflicts: conflicts,
 	}
+}
 
-	return table
+// The reduction of item is favored over the shift of token only when both
+// have a precedence and the rule's is the higher.
+func (g *grammar) reduceFavored(token string, item *LRItem) bool {
+	sLevel := g.precedence[token]
+	return sLevel > 0 && g.productions[item.number].precLevel > sLevel
 }
 
 func turnAction2id(action string) int {
@@ -561,13 +861,42 @@ func turnAction2id(action string) int {
 	return state
 }
 
+// LR(0) reduces a complete item whatever the lookahead is
+func (self *lrTable) addLR0Lookaheads() {
+	g := self.grammar
+	for state, closure := range self.closures {
+		for _, item := range closure {
+			if (item.lrIndex + 1) != item.len {
+				continue
+			}
+			heads := self.itemLookaheads(item, state)
+			for t := range g.terminals {
+				heads.add(t)
+			}
+		}
+	}
+}
+
+// SLR(1) reduces a complete item A -> w . on the FOLLOW set of A
+func (self *lrTable) addSLRLookaheads() {
+	g := self.grammar
+	for state, closure := range self.closures {
+		for _, item := range closure {
+			if (item.lrIndex + 1) != item.len {
+				continue
+			}
+			self.itemLookaheads(item, state).addSet(g.follow[item.name])
+		}
+	}
+}
+
 func (self *lrTable) addLalrLookheads() {
-	nullable := self.computeNullableNonterminals()
+	nullable := self.grammar.nullableNonterminals()
 
 	trans := self.findNonterminalTransition()
 
 	// get the next terminal in each trans
-	readsets := self.computeReadSets(trans)
+	readsets := self.computeReadSets(trans, nullable)
 
 	lookd, included := self.computeLookbackIncludes(trans, nullable)
 
@@ -576,44 +905,43 @@ func (self *lrTable) addLalrLookheads() {
 	self.addLookaheads(lookd, followSets)
 }
 
+// Get the lookaheads of the item in state, the set is created on demand. The
+// lookaheads are kept by the table since the items are shared by the tables
+// built from the grammar.
+func (self *lrTable) itemLookaheads(item *LRItem, state int) *StrSet {
+	states, ok := self.lookaheads[item]
+	if !ok {
+		states = make(map[int]*StrSet)
+		self.lookaheads[item] = states
+	}
+	if _, ok := states[state]; !ok {
+		states[state] = createSet()
+	}
+	return states[state]
+}
+
 func (self *lrTable) addLookaheads(lookd map[string][]*looked, followSets map[string]*StrSet) {
 	for tran, lookb := range lookd {
 		for _, l := range lookb {
 			state := l.state
 			prod := l.item
-			if _, ok := prod.lookaheads[state]; !ok {
-				prod.lookaheads[state] = createSet()
-			}
+			heads := self.itemLookaheads(prod, state)
 
 			follow := followSets[tran]
 			follow.forEach(func(f string){
-				if !prod.lookaheads[state].contains(f) {
-					prod.lookaheads[state].add(f)
+				if !heads.contains(f) {
+					heads.add(f)
 				}
 			})
 		}
 	}
 }
 
-func (self *lrTable ) computeFollowSets(trans *StrSet, readsets map[string]*StrSet, included map[string]*StrSet) map[string]*StrSet {
-	followsets := make(map[string]*StrSet)
-
-	trans.forEach(func(tran string) {
-		if _, ok := followsets[tran]; !ok {
-			followsets[tran] = createSet()
-		}
-		followTerminals := readsets[tran]
-		followsets[tran].addSet(followTerminals)
-
-		if includedSet, ok := included[tran]; ok {
-			includedSet.forEach(func(i string) {
-				followsets[tran].addSet(readsets[i])
-			})
-		}
-	})
-
-	return followsets
+// FOLLOW(p,A) is READ(p,A) plus the FOLLOW of every transition (p,A) INCLUDES.
+func (self *lrTable ) computeFollowSets(trans *StrSet, readsets map[string]*StrSet, included map[string][]string) map[string]*StrSet {
+	return self.digraph(trans.sorted(), readsets, included)
 }
+
 // Determines the lookback and includes relations
 //
 // LOOKBACK:
@@ -637,12 +965,14 @@ func (self *lrTable ) computeFollowSets(trans *StrSet, readsets map[string]*StrS
 // L is essentially a prefix (which may be empty), T is a suffix that must be
 // able to derive an empty string.  State p' must lead to state p with the string L.
 //
-func (self *lrTable) computeLookbackIncludes(trans *StrSet, nullable *StrSet) (map[string][]*looked, map[string]*StrSet) {
-	lookDict := make(map[string][]*looked)
-	includedDict := make(map[string]*StrSet)
-
-	// loop over all transitions and compute lookbacks and includes
-	trans.forEach(func(tran string){
+func (self *lrTable) computeLookbackIncludes(trans *StrSet, nullable *StrSet) (map[string][]*looked, map[string][]string) {
+	tranList := trans.sorted()
+	lookbs := make([][]*looked, len(tranList))
+	includes := make([][]string, len(tranList))
+
+	// loop over all transitions and compute lookbacks and includes, in parallel
+	self.parallel(len(tranList), func(ti int) {
+		tran := tranList[ti]
 		state, nonTerminal := getStateAndNonterminal(tran)
 		lookb := make([]*looked, 0)
 		included := createSet()
@@ -687,8 +1017,7 @@ func (self *lrTable) computeLookbackIncludes(trans *StrSet, nullable *StrSet) (m
 				}
 
 				// go to next set
-				cGoto := self.lr0Goto(self.closures[currentState], token)
-				currentState = self.closureMap[hashLRItems(cGoto)]
+				currentState = self.transitions[currentState][token]
 			}
 
 			// When we get here, currentState is the final state, now we have to locate the production
@@ -719,41 +1048,55 @@ func (self *lrTable) computeLookbackIncludes(trans *StrSet, nullable *StrSet) (m
 			}
 		}
 
-		lookDict[tran] = lookb
-		included.forEach(func(item string) {
-			if _, ok := includedDict[item]; !ok {
-				includedDict[item] = createSet()
-			}
-			includedDict[item].add(tran)
-		})
+		lookbs[ti] = lookb
+		includes[ti] = included.sorted()
 	})
 
+	lookDict := make(map[string][]*looked)
+	includedDict := make(map[string][]string)
+	for ti, tran := range tranList {
+		lookDict[tran] = lookbs[ti]
+		for _, item := range includes[ti] {
+			includedDict[item] = append(includedDict[item], tran)
+		}
+	}
+
 	return lookDict, includedDict
 }
 
-func (self *lrTable) computeReadSets(trans *StrSet) map[string]*StrSet {
-	readset := make(map[string]*StrSet)
+// READ(p,A) is the set of terminals that can be read right after the
+// transition (p,A). The direct ones are shifted from goto(p,A); the others
+// come through (p,A) READS (r,C), where r = goto(p,A) and C is nullable.
+func (self *lrTable) computeReadSets(trans *StrSet, nullable *StrSet) map[string]*StrSet {
+	tranList := trans.sorted()
+	direct := make([]*StrSet, len(tranList))
+	reads := make([][]string, len(tranList))
 
-	trans.forEach(func(tran string) {
-		state, nonTerminal := getStateAndNonterminal(tran)
-		readset[tran] = createSet()
-
-		if state == 0 {
-			readset[tran].add(ENDTOKEN)
-		}
+	self.parallel(len(tranList), func(i int) {
+		state, nonTerminal := getStateAndNonterminal(tranList[i])
+		direct[i] = createSet()
 
-		cGoto := self.lr0Goto(self.closures[state], nonTerminal)
-		for _, lrItem := range cGoto {
+		gotoState := self.transitions[state][nonTerminal]
+		for _, lrItem := range self.closures[gotoState] {
 			if lrItem.lrIndex < (lrItem.len - 1) {
 				a := (*lrItem.prod)[lrItem.lrIndex + 1]
 				if _, ok := self.grammar.terminals[a]; ok {
-					readset[tran].add(a)
+					direct[i].add(a)
+				} else if nullable.contains(a) {
+					reads[i] = append(reads[i], fmt.Sprintf("%d-%s", gotoState, a))
 				}
 			}
 		}
 	})
 
-	return readset
+	readset := make(map[string]*StrSet)
+	relation := make(map[string][]string)
+	for i, tran := range tranList {
+		readset[tran] = direct[i]
+		relation[tran] = reads[i]
+	}
+
+	return self.digraph(tranList, readset, relation)
 }
 
 func getStateAndNonterminal(s string) (int, string) {
@@ -768,12 +1111,12 @@ func getStateAndNonterminal(s string) (int, string) {
 }
 
 // Creates a dictionary containing all of the non-terminals that might produce an empty production.
-func (self *lrTable) computeNullableNonterminals() *StrSet {
+func (g *grammar) nullableNonterminals() *StrSet {
 	nullable := createSet()
 	numNullable := 0
 
 	for {
-		for _, p := range self.grammar.productions[1:] {
+		for _, p := range g.productions[1:] {
 			if p.prodSize == 0 {
 				nullable.add(p.name)
 				continue
@@ -825,66 +1168,64 @@ func (self *lrTable) findNonterminalTransition() *StrSet {
 	return trans
 }
 
-// get all the states of LR(0) closures
+// get all the states of LR(0) closures, and the transitions between them
 func (self *lrTable) lr0Items() [][]*LRItem {
 	closures := make([][]*LRItem, 0)
 	closures = append(closures, self.lr0Closure(&[]*LRItem{
 		self.grammar.productions[0].lrNext,
 	}))
-	i := 0
-	for _, item := range closures {
-		self.closureMap[hashLRItems(item)] = i
-		i++
-	}
-
-	// Loop over the items in C and each grammar symbols
-	i = 0
-	// len has to be invoked each iteration since the length of the closure is increasing
-	for i < len(closures) {
-		cItem := closures[i]
-		i++
-
-		allSymbols := createSet()
-		for _, lrItem := range cItem {
-			allSymbols.addSet(lrItem.symSet)
-		}
-
-		allSymbols.forEach(func(symbol string){
-			cGoto := self.lr0Goto(cItem, symbol)
-			if len(cGoto) == 0 || self.closureMap[hashLRItems(cGoto)] != 0 {
-				// continue
-			} else {
-				self.closureMap[hashLRItems(cGoto)] = len(closures)
-				closures = append(closures, cGoto)
+	self.states.intern(closures[0])
+
+	// The states are found breadth first. The gotos of the states found last
+	// are computed in parallel, then interned in the order of the states and
+	// of their symbols, so the states are numbered as if one by one.
+	frontier := []int{0}
+	for len(frontier) > 0 {
+		symbols := make([][]string, len(frontier))
+		gotos := make([][][]*LRItem, len(frontier))
+		self.parallel(len(frontier), func(i int) {
+			cItem := closures[frontier[i]]
+			seen := createSet()
+			// the symbols after the dots, in the order of the items, so that the
+			// states are numbered the same way by every build
+			for _, lrItem := range cItem {
+				if (lrItem.lrIndex + 1) == lrItem.len {
+					continue
+				}
+				symbol := (*lrItem.prod)[lrItem.lrIndex + 1]
+				if seen.contains(symbol) {
+					continue
+				}
+				seen.add(symbol)
+				symbols[i] = append(symbols[i], symbol)
+				gotos[i] = append(gotos[i], self.lr0Goto(cItem, symbol))
 			}
 		})
-	}
-
-	return closures
-}
 
-func hashLRItem(lr *LRItem) int {
-	result := lr.String()
-	hash := md5.Sum([]byte(result))
-
-	return int(binary.LittleEndian.Uint32(hash[:]))
-}
-
-// compute hash with the concat of 
-func hashLRItems(lr []*LRItem) int {
-	result := ""
-	for _, item := range lr {
-		result += item.String()
+		next := make([]int, 0)
+		for i, state := range frontier {
+			trans := make(map[string]int)
+			self.transitions[state] = trans
+			for j, symbol := range symbols[i] {
+				stateId, added := self.states.intern(gotos[i][j])
+				if added {
+					closures = append(closures, gotos[i][j])
+					next = append(next, stateId)
+				}
+				trans[symbol] = stateId
+			}
+		}
+		frontier = next
 	}
 
-	hash := md5.Sum([]byte(result))
-	
-	return int(binary.LittleEndian.Uint32(hash[:]))
+	return closures
 }
 
 // Compute the LR(0) closure operation on items, where items is a array of LR(0) items.
+// The closures of the states are computed in parallel, so the productions
+// already added are marked in a slice of the call.
 func (self *lrTable) lr0Closure(items *[]*LRItem) []*LRItem {
-	self.addCount++
+	added := make([]bool, len(self.grammar.productions))
 
 	result := make([]*LRItem, 0)
 	result = append(result, *items...)
@@ -894,11 +1235,11 @@ func (self *lrTable) lr0Closure(items *[]*LRItem) []*LRItem {
 		didAdd = false
 		for _, item := range result {
 			for _, after := range item.lrAfter {
-				if after.lr0Added == self.addCount {
+				if added[after.id] {
 					continue
 				}
 				result = append(result, after.lrNext)
-				after.lr0Added = self.addCount
+				added[after.id] = true
 				didAdd = true
 			}
 		}
@@ -908,56 +1249,22 @@ func (self *lrTable) lr0Closure(items *[]*LRItem) []*LRItem {
 }
 
 // Compute the LR(0) goto function goto(lrs,symbol) where I is a set
-// of LR(0) items and X is a grammar symbol.   This function is written
-// in a way that guarantees uniqueness of the generated goto sets
+// of LR(0) items and X is a grammar symbol. The items of a closure are
+// distinct, and so are the items after them.
 func (self *lrTable) lr0Goto(lrs []*LRItem, symbol string) []*LRItem {
-	// First we look for a previously cached entry
-	lrCacheKey := fmt.Sprintf("%d-%s", hashLRItems(lrs), symbol)
-	if lGoto, ok := self.lrGotoCache[lrCacheKey]; ok { 
-		return lGoto
-	}
-
-	// Now we generate the goto set in a way that guarantees uniqueness
-	// of the result
-	s := self.symbolGotoCache[lrCacheKey]
-	if s == nil {
-		s = &symbolCache{
-			transfer: make(map[int]int),
-			end: make([]*LRItem, 0),
-		}
-		self.symbolGotoCache[lrCacheKey] = s
-	}
-
 	sGoto := make([]*LRItem, 0)
-	var currentId int
 	for _, lrItem := range lrs {
 		next := lrItem.lrNext
 		// the next in front of the dot is the symbol
 		if next != nil && next.lrBefore == symbol {
-			nextHash := hashLRItem(next)
-			_, isExist := s.transfer[nextHash]
-			if !isExist {
-				if currentId == 0 {
-					currentId = nextHash
-					s.transfer[currentId] = currentId
-				} else {
-					s.transfer[currentId] = nextHash
-					currentId = nextHash
-				}
-				sGoto = append(sGoto, next)
-			}
+			sGoto = append(sGoto, next)
 		}
 	}
 
-	if len(s.end) == 0 {
-		if len(sGoto) > 0 {
-			s.end = self.lr0Closure(&sGoto)
-		} else {
-			s.end = make([]*LRItem, 0)
-		}
+	if len(sGoto) == 0 {
+		return sGoto
 	}
-	self.lrGotoCache[lrCacheKey] = s.end
-	return self.lrGotoCache[lrCacheKey]
+	return self.lr0Closure(&sGoto)
 }
 
 func createLRItem(g *grammar,p *production, dotIndex int) *LRItem {
@@ -965,7 +1272,6 @@ func createLRItem(g *grammar,p *production, dotIndex int) *LRItem {
 		name: p.name,
 		number: p.id,
 		lrIndex: dotIndex,
-		lookaheads: make(map[int]*StrSet),
 		symSet: p.symSet,
 		len: 0,
 	}
@@ -1005,7 +1311,22 @@ func (self *LRItem) String() string {
 	return s
 }
 
-func CreateGrammar(l *Lexer, r []*SyntaxRule, p []*Precedence) *grammar {
+func CreateGrammar[T any](l *Lexer, r []*SyntaxRule[T], p []*Precedence) *grammar {
+	grammar := defineGrammar(l, r, p)
+	grammar.prepare()
+	return grammar
+}
+
+// prepare for the establishment of LRTable
+func (g *grammar) prepare() {
+	g.buildLRItems()
+	g.buildFirst()
+	g.buildFollow()
+}
+
+// Define the symbols and the productions of the grammar, without preparing
+// the construction of its LR table
+func defineGrammar[T any](l *Lexer, r []*SyntaxRule[T], p []*Precedence) *grammar {
 	grammar := &grammar{
 		productions:  make([]*production, 0),
 		prodNames:    make(map[string][]*production),
@@ -1029,17 +1350,12 @@ func CreateGrammar(l *Lexer, r []*SyntaxRule, p []*Precedence) *grammar {
 	grammar.terminals[ENDTOKEN] = []int{}
 
 	grammar.setPrecedence(p)
-	grammar.setRules(r)
+	setRules(grammar, r)
 	grammar.start = "S'"
 
 	// check unused, undefined, unreachable, cycles
 	grammar.checkGrammar()
 
-	// prepare for the establishment of LRTable
-	grammar.buildLRItems()
-	grammar.buildFirst()
-	grammar.buildFollow()
-
 	return grammar
 }
 
@@ -1064,7 +1380,8 @@ func (g *grammar) buildFollow() {
 
 	for {
 		didAdd := false
-		for _, production := range g.productions[1:] {
+		// the augmented production gives $end to the start rule
+		for _, production := range g.productions {
 			for index, symbol := range production.prod {
 				if _, ok := g.nonterminals[symbol]; !ok {
 					continue
@@ -1126,7 +1443,9 @@ func (g *grammar) buildFirst() {
 		changed := false
 		for n := range g.nonterminals {
 			for _, p := range g.prodNames[n] {
-				changed = g.setFirstFromProd(n, &p.prod)
+				if g.setFirstFromProd(n, &p.prod) {
+					changed = true
+				}
 			}
 		}
 		if !changed {
@@ -1135,6 +1454,8 @@ func (g *grammar) buildFirst() {
 	}
 }
 
+// The FIRST set of the symbols p, which holds <empty> if all the symbols of p
+// are nullable.
 func (g *grammar) getFirstFromProd(p *[]string) *StrSet {
 	result := createSet()
 
@@ -1142,22 +1463,20 @@ func (g *grammar) getFirstFromProd(p *[]string) *StrSet {
 		firsts := g.first[x]
 		hasEmpty := false
 		firsts.forEach(func(s string) {
-			if !result.contains(s) {
-				result.add(s)
-			}
-
 			// empty case
 			if s == EMPTYTOKEN {
-				result.add(EMPTYTOKEN)
 				hasEmpty = true
+			} else {
+				result.add(s)
 			}
 		})
 
 		if !hasEmpty {
-			break
+			return result
 		}
 	}
 
+	result.add(EMPTYTOKEN)
 	return result
 }
 
@@ -1166,26 +1485,12 @@ func (g *grammar) setFirstFromProd(name string, p *[]string) bool {
 	nSet := g.first[name]
 	changed := false
 
-	for _, x := range *p {
-		firsts := g.first[x]
-		hasEmpty := false
-		firsts.forEach(func(s string) {
-			if !nSet.contains(s) {
-				nSet.add(s)
-				changed = true
-			}
-
-			// empty case
-			if s == EMPTYTOKEN {
-				nSet.add(EMPTYTOKEN)
-				hasEmpty = true
-			}
-		})
-
-		if !hasEmpty {
-			break
+	g.getFirstFromProd(p).forEach(func(s string) {
+		if !nSet.contains(s) {
+			nSet.add(s)
+			changed = true
 		}
-	}
+	})
 
 	return changed
 }
@@ -1245,27 +1550,55 @@ func (g *grammar) setPrecedence(precs []*Precedence) {
 	}
 }
 
-func (g *grammar) setRules(rules []*SyntaxRule) {
+func setRules[T any](g *grammar, rules []*SyntaxRule[T]) {
 	if  len(rules) == 0 {
 		panic("no rules!")
 	}
 
+	templates := createTemplateSet(g, rules)
+
+	// the first rule which is not a template is the start rule
+	var start *SyntaxRule[T]
+	for _, rule := range rules {
+		if len(rule.Params) == 0 {
+			start = rule
+			break
+		}
+	}
+	if start == nil {
+		panic("no rules except templates!")
+	}
+
 	// add start rule
-	g.addProduction("S'", []string{rules[0].Name, ENDTOKEN}, nil)
+	g.addProduction("S'", []string{start.Name, ENDTOKEN}, nil, nil)
 	for _, rule := range rules {
 		// valid whether it is terminal type
 		if _, ok := g.terminals[rule.Name]; ok {
 			panic("duplicate name with tokentype")
 		}
+		if len(rule.Params) > 0 {
+			continue
+		}
+		if templates.has(rule.Name) {
+			panic(fmt.Sprintf("duplicate name with template %s", rule.Name))
+		}
 		for _, ops := range rule.Expand {
 
-			rOps := expStr2Arr(ops.Ops)
-			g.addProduction(rule.Name, rOps, ops.RFunc)
+			rOps, labels := splitLabels(rule.Name, expStr2Arr(ops.Ops))
+			templates.use(rOps)
+			mids := bindMidActions(rule.Name, ops, rOps, labels)
+			action := bindAction(rule.Name, ops, labels)
+			g.addProduction(rule.Name, rOps, action, mids).labels = labels
 		}
 	}
+
+	// expand the template calls into concrete productions
+	templates.instantiate()
 }
 
-func (g *grammar) addProduction(name string, rOps []string, rFunc func([]PValue) (PValue, error)) {
+// Add the production name -> rOps. The mid-rule actions in rOps, bound in
+// mids by their placeholders, are replaced by hidden empty nonterminals.
+func (g *grammar) addProduction(name string, rOps []string, action any, mids map[string]any) *production {
 	precInfo, opsArr := g.getPrecedence(name, rOps)
 	var ops []string
 	if opsArr != nil {
@@ -1274,6 +1607,22 @@ func (g *grammar) addProduction(name string, rOps []string, rFunc func([]PValue)
 		ops = rOps
 	}
 
+	if len(mids) > 0 {
+		origin := fmt.Sprintf("%s -> %s", name, strings.Join(ops, " "))
+		ops = append([]string{}, ops...)
+		for i, item := range ops {
+			if !isMidAction(item) {
+				continue
+			}
+			g.midCount++
+			hidden := fmt.Sprintf("$@%d", g.midCount)
+			mid := g.addProduction(hidden, []string{}, mids[item], nil)
+			mid.midDepth = i
+			mid.midOf = fmt.Sprintf("%s in %s", item, origin)
+			ops[i] = hidden
+		}
+	}
+
 	// see if the rule is already defined
 	ruleId := fmt.Sprintf("%s->%s", name, strings.Join(ops, " "))
 	if _, ok := g.prodMap[ruleId]; ok {
@@ -1299,7 +1648,7 @@ func (g *grammar) addProduction(name string, rOps []string, rFunc func([]PValue)
 	}
 
 	// create a production and add it to the list of productions
-	p := createProduction(pnumber, name, ops, precInfo, rFunc)
+	p := createProduction(pnumber, name, ops, precInfo, action)
 	g.productions = append(g.productions, p)
 	g.prodMap[ruleId] = pnumber
 
@@ -1309,6 +1658,8 @@ func (g *grammar) addProduction(name string, rOps []string, rFunc func([]PValue)
 		g.prodNames[name] = []*production{}
 	}
 	g.prodNames[name] = append(g.prodNames[name], p)
+
+	return p
 }
 
 func (g *grammar) getPrecedence(name string, rOps []string) (int, []string) {
@@ -1358,6 +1709,16 @@ func (g *grammar) rightMostTerminal(ops []string) string {
 	return ""
 }
 
+// Describe the item for the conflicts, the item of a mid-rule action is
+// described by the rule containing the action.
+func (g *grammar) itemOrigin(lr *LRItem) string {
+	prod := g.productions[lr.number]
+	if prod.midOf == "" {
+		return lr.String()
+	}
+	return "mid-rule action " + prod.midOf
+}
+
 func (g *grammar) checkGrammar() {
 	g.undefinedSymbols()
 	g.unusedTerminals()
@@ -1534,14 +1895,104 @@ func (g *grammar) string() string {
 }
 
 
+// Split the ops of a rule into symbols. Words, %prec, template calls and
+// mid-rule actions {name} are symbols, the other characters are ignored. A
+// template call is kept as one symbol in its canonical form without spaces,
+// e.g. separated_list(COMMA,expr).
+// A labelled symbol is kept as label=symbol, see splitLabels.
 func expStr2Arr(s string) []string {
-  // write regexp to get word from string and convert them to array
-  // precedence case must be considered
-  reg := regexp.MustCompile(`\w+|%prec`)
-  return reg.FindAllString(s, -1)
+	result := make([]string, 0)
+	i := 0
+	for i < len(s) {
+		// mid-rule action
+		if s[i] == '{' {
+			end := strings.Index(s[i:], "}")
+			if end < 0 {
+				panic(fmt.Sprintf("unclosed mid-rule action in \"%s\"", s))
+			}
+			result = append(result, "{"+strings.TrimSpace(s[i+1:i+end])+"}")
+			i += end + 1
+			continue
+		}
+
+		if !isSymbolChar(s[i]) {
+			i++
+			continue
+		}
+
+		word, end := scanSymbol(s, i)
+		i = end
+
+		// label
+		next := skipBlank(s, i)
+		if next < len(s) && s[next] == '=' {
+			next = skipBlank(s, next+1)
+			if next == len(s) || !isSymbolChar(s[next]) {
+				panic(fmt.Sprintf("label %s is not followed by a symbol in \"%s\"", word, s))
+			}
+			sym, end := scanSymbol(s, next)
+			word = word + "=" + sym
+			i = end
+		}
+
+		result = append(result, word)
+	}
+	return result
+}
+
+// scan the word or template call starting at s[start]
+func scanSymbol(s string, start int) (string, int) {
+	i := start
+	for i < len(s) && isSymbolChar(s[i]) {
+		i++
+	}
+	word := s[start:i]
+
+	// template call
+	next := skipBlank(s, i)
+	if next < len(s) && s[next] == '(' {
+		return scanTemplateCall(word, s, next)
+	}
+	return word, i
+}
+
+func skipBlank(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// Remove the labels from the symbols of ops. The returned map gives the
+// position of each labelled symbol.
+func splitLabels(name string, ops []string) ([]string, map[string]int) {
+	syms := make([]string, len(ops))
+	labels := make(map[string]int)
+	for i, item := range ops {
+		eq := strings.Index(item, "=")
+		if eq < 0 || strings.Contains(item[:eq], "(") {
+			syms[i] = item
+			continue
+		}
+
+		label := item[:eq]
+		if _, ok := labels[label]; ok {
+			panic(fmt.Sprintf("duplicate label %s in rule %s", label, name))
+		}
+		labels[label] = i
+		syms[i] = item[eq+1:]
+	}
+	return syms, labels
+}
+
+// @ marks the captures in the tags of the struct grammar, see structgrammar.go,
+// and . separates the namespaces of the modules, see module.go
+func isSymbolChar(c byte) bool {
+	return c == '_' || c == '%' || c == '@' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
 }
 
-func createProduction(pnumber int, name string, ops []string, precInfo int, pfunc func([]PValue) (PValue, error)) *production {
+func createProduction(pnumber int, name string, ops []string, precInfo int, action any) *production {
 	p := &production{
 		id: pnumber,
 		name: name,
@@ -1550,7 +2001,7 @@ func createProduction(pnumber int, name string, ops []string, precInfo int, pfun
 		// get the unique symbols in production
 		symSet: createSet(),
 		precLevel: 0,
-		pFunc: pfunc,
+		action: action,
 		lrItems: make([]*LRItem, 0),
 		lrNext: nil,
 	}
@@ -1583,8 +2034,8 @@ func debugPrintClosures(table *lrTable) {
 		fmt.Printf("Closure %d:\n", cIndex)
 		for lIndex, lr := range closure {
 			fmt.Printf("%d.%d - %s \n", cIndex, lIndex, lr.String())
-			if _, ok := lr.lookaheads[cIndex]; ok {
-				fmt.Printf("  lookaheads: %s \n", lr.lookaheads[cIndex].string())
+			if heads, ok := table.lookaheads[lr][cIndex]; ok {
+				fmt.Printf("  lookaheads: %s \n", heads.string())
 			}
 		}
 	}
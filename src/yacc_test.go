@@ -16,10 +16,10 @@ func TestCreateGrammar(t *testing.T) {
 
 	l := CreateLexer(symbols, ignores)
 
-	rules := []*SyntaxRule {
+	rules := []*SyntaxRule[any] {
 		{
 			Name: "expr",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				 {
 					Ops: "terms PLUS terms",
 				},
@@ -27,7 +27,7 @@ func TestCreateGrammar(t *testing.T) {
 		},
 		{
 			Name: "terms",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				 {
 					Ops: "NUMBER",
 				},
@@ -52,10 +52,10 @@ func TestCheckGrammar(t *testing.T) {
 
 	l := CreateLexer(symbols, ignores)
 
-	rules := []*SyntaxRule {
+	rules := []*SyntaxRule[any] {
 		{
 			Name: "s",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				 {
 					Ops: "e PLUS e",
 				},
@@ -63,7 +63,7 @@ func TestCheckGrammar(t *testing.T) {
 		},
 		{
 			Name: "e",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				 {
 					Ops: "r",
 				},
@@ -71,7 +71,7 @@ func TestCheckGrammar(t *testing.T) {
 		},
 		{
 			Name: "r",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				 {
 					Ops: "s",
 				},
@@ -79,7 +79,7 @@ func TestCheckGrammar(t *testing.T) {
 		},
 		{
 			Name: "t",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				 {
 					Ops: "NUMBER",
 				},
@@ -140,10 +140,10 @@ func createCalcGrammar() *grammar {
 		},
 	}
 
-	rules := []*SyntaxRule {
+	rules := []*SyntaxRule[any] {
 		{
 			Name: "statement",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				{
 					Ops: "NAME ASSIGN expr",
 				},
@@ -154,7 +154,7 @@ func createCalcGrammar() *grammar {
 		},
 		{
 			Name: "expr",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				{
 					Ops: "expr PLUS expr",
 				},
@@ -191,7 +191,7 @@ func createCalcGrammar() *grammar {
 
 func TestLRTable(t *testing.T) {
 	g := createCalcGrammar()
-	createLRTable(g)
+	createLRTable(g, LALR1)
 }
 
 func TestCreateParser(t *testing.T) {
@@ -236,10 +236,10 @@ func TestCreateParser(t *testing.T) {
 		},
 	}
 
-	rules := []*SyntaxRule {
+	rules := []*SyntaxRule[any] {
 		{
 			Name: "statement",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				{
 					Ops: "NAME ASSIGN expr",
 				},
@@ -250,7 +250,7 @@ func TestCreateParser(t *testing.T) {
 		},
 		{
 			Name: "expr",
-			Expand: []*RuleOps {
+			Expand: []*RuleOps[any] {
 				{
 					Ops: "expr PLUS expr",
 				},
@@ -281,4 +281,103 @@ func TestCreateParser(t *testing.T) {
 	
 	p := CreateParser(symbols, ignores, rules, precedences)
 	p.WriteMDInfo("calc", "../")
-}
\ No newline at end of file
+}
+func TestLalrLookaheads(t *testing.T) {
+	symbols := map[string]string {
+		"X": "x",
+		"C": "c",
+		"NUMBER": "[0-9]+",
+		"SEMI": ";",
+	}
+	ignores := []string{" "}
+	nothing := func(vals []Value[any]) (any, error) {
+		return nil, nil
+	}
+
+	// a -> X is reduced on C, which is read after the nullable b
+	reads := []*SyntaxRule[any] {
+		{
+			Name: "s",
+			Expand: []*RuleOps[any] {
+				{Ops: "a b C", RFunc: nothing},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any] {
+				{Ops: "X", RFunc: nothing},
+			},
+		},
+		{
+			Name: "b",
+			Expand: []*RuleOps[any] {
+				{Ops: "", RFunc: nothing},
+			},
+		},
+	}
+	if _, err := CreateParser(symbols, ignores, reads, []*Precedence{}).Parse("x c"); err != nil {
+		t.Errorf("Expected a parse through READS, got %v", err)
+	}
+
+	// f -> NUMBER is reduced on SEMI, which follows e through a chain of
+	// INCLUDES
+	includes := []*SyntaxRule[any] {
+		{
+			Name: "s",
+			Expand: []*RuleOps[any] {
+				{Ops: "e SEMI", RFunc: nothing},
+			},
+		},
+		{
+			Name: "e",
+			Expand: []*RuleOps[any] {
+				{Ops: "t", RFunc: nothing},
+			},
+		},
+		{
+			Name: "t",
+			Expand: []*RuleOps[any] {
+				{Ops: "f", RFunc: nothing},
+			},
+		},
+		{
+			Name: "f",
+			Expand: []*RuleOps[any] {
+				{Ops: "NUMBER", RFunc: nothing},
+			},
+		},
+	}
+	if _, err := CreateParser(symbols, ignores, includes, []*Precedence{}).Parse("1;"); err != nil {
+		t.Errorf("Expected a parse through INCLUDES, got %v", err)
+	}
+
+	// $end is read after s only, so a -> NUMBER is reduced on X and
+	// b -> NUMBER on $end, without a reduce/reduce conflict
+	start := []*SyntaxRule[any] {
+		{
+			Name: "s",
+			Expand: []*RuleOps[any] {
+				{Ops: "a X", RFunc: nothing},
+				{Ops: "b", RFunc: nothing},
+			},
+		},
+		{
+			Name: "a",
+			Expand: []*RuleOps[any] {
+				{Ops: "NUMBER", RFunc: nothing},
+			},
+		},
+		{
+			Name: "b",
+			Expand: []*RuleOps[any] {
+				{Ops: "NUMBER", RFunc: nothing},
+			},
+		},
+	}
+	p := CreateParser(symbols, ignores, start, []*Precedence{})
+	for _, input := range []string{"1 x", "1"} {
+		if _, err := p.Parse(input); err != nil {
+			t.Errorf("Expected a parse of %s, got %v", input, err)
+		}
+	}
+}